@@ -0,0 +1,350 @@
+// Package analytics computes build stability figures (failure rates, flips,
+// recovery time and flaky jobs) from the build history of a project.
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+	"github.com/u2takey/kci-sdk-go/testreport"
+)
+
+// BranchStats summarizes the builds of one branch.
+type BranchStats struct {
+	Branch      string
+	Builds      int // finished builds that passed or failed
+	Failures    int
+	FailureRate float64
+	Flips       int           // failure streaks with a passing build on both sides
+	Recoveries  int           // failure streaks that were followed by a pass
+	MTTR        time.Duration // mean time from first failure to next pass
+}
+
+// FlakyJob is a job that both passed and failed on the same commit.
+type FlakyJob struct {
+	JobNum       int
+	Reruns       int      // commits where this job ran more than once
+	FlakyCommits []string // commits where it both passed and failed
+	Runs         int      // runs on re-run commits
+	Failures     int      // failed runs on re-run commits
+}
+
+// Score is the share of re-run commits on which the job flipped.
+func (j *FlakyJob) Score() float64 {
+	if j.Reruns == 0 {
+		return 0
+	}
+	return float64(len(j.FlakyCommits)) / float64(j.Reruns)
+}
+
+// FlakyTest is a test that both passed and failed on the same commit.
+type FlakyTest struct {
+	Package  string
+	Name     string
+	Commits  []string
+	Passed   int
+	Failures int
+}
+
+// Report is the stability report of a project.
+type Report struct {
+	ProjectId   int64
+	Builds      int
+	Failures    int
+	FailureRate float64
+	Branches    []*BranchStats
+	FlakyJobs   []*FlakyJob
+	FlakyTests  []*FlakyTest // only filled when Options.Tests is set
+}
+
+// Options controls how much is fetched by ForProject.
+type Options struct {
+	Tests bool // parse job logs of re-run commits to find flaky tests
+}
+
+// passed maps a status to an outcome; ok is false for builds that neither
+// passed nor failed (running, killed, skipped ...).
+func passed(status string) (pass, ok bool) {
+	switch status {
+	case kciClient.StatusSuccess:
+		return true, true
+	case kciClient.StatusFailure, kciClient.StatusError:
+		return false, true
+	}
+	return false, false
+}
+
+// Analyze computes a report from builds. Jobs are taken from Build.Jobs, so
+// flaky jobs are only found for builds that carry them.
+func Analyze(builds []*kciClient.Build) *Report {
+	r := new(Report)
+	byBranch := map[string][]*kciClient.Build{}
+	for _, b := range builds {
+		if r.ProjectId == 0 {
+			r.ProjectId = b.ProjectId
+		}
+		pass, ok := passed(b.Status)
+		if !ok {
+			continue
+		}
+		r.Builds++
+		if !pass {
+			r.Failures++
+		}
+		byBranch[b.Branch] = append(byBranch[b.Branch], b)
+	}
+	r.FailureRate = rate(r.Failures, r.Builds)
+
+	for branch, bs := range byBranch {
+		r.Branches = append(r.Branches, branchStats(branch, bs))
+	}
+	sort.Sort(byFailureRate(r.Branches))
+	r.FlakyJobs = flakyJobs(builds)
+	return r
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func branchStats(branch string, builds []*kciClient.Build) *BranchStats {
+	sort.Sort(byNumber(builds))
+	s := &BranchStats{Branch: branch, Builds: len(builds)}
+	var (
+		seenPass bool
+		failedAt time.Time // finish time of the first failure of the streak
+		inStreak bool
+		downtime time.Duration
+	)
+	for _, b := range builds {
+		pass, _ := passed(b.Status)
+		if !pass {
+			s.Failures++
+			if !inStreak {
+				inStreak, failedAt = true, b.Finished
+			}
+			continue
+		}
+		if inStreak {
+			s.Recoveries++
+			downtime += b.Finished.Sub(failedAt)
+			if seenPass {
+				s.Flips++
+			}
+			inStreak = false
+		}
+		seenPass = true
+	}
+	s.FailureRate = rate(s.Failures, s.Builds)
+	if s.Recoveries > 0 {
+		s.MTTR = downtime / time.Duration(s.Recoveries)
+	}
+	return s
+}
+
+// rerunCommits groups finished builds by commit, keeping commits built more
+// than once.
+func rerunCommits(builds []*kciClient.Build) map[string][]*kciClient.Build {
+	byCommit := map[string][]*kciClient.Build{}
+	for _, b := range builds {
+		if _, ok := passed(b.Status); ok && b.Commit != "" {
+			byCommit[b.Commit] = append(byCommit[b.Commit], b)
+		}
+	}
+	for commit, bs := range byCommit {
+		if len(bs) < 2 {
+			delete(byCommit, commit)
+		}
+	}
+	return byCommit
+}
+
+func flakyJobs(builds []*kciClient.Build) []*FlakyJob {
+	jobs := map[int]*FlakyJob{}
+	for commit, bs := range rerunCommits(builds) {
+		type outcome struct{ runs, pass, fail int }
+		outcomes := map[int]*outcome{}
+		for _, b := range bs {
+			for _, job := range b.Jobs {
+				pass, ok := passed(job.Status)
+				if !ok {
+					continue
+				}
+				o := outcomes[job.Number]
+				if o == nil {
+					o = new(outcome)
+					outcomes[job.Number] = o
+				}
+				o.runs++
+				if pass {
+					o.pass++
+				} else {
+					o.fail++
+				}
+			}
+		}
+		for num, o := range outcomes {
+			if o.runs < 2 {
+				continue
+			}
+			j := jobs[num]
+			if j == nil {
+				j = &FlakyJob{JobNum: num}
+				jobs[num] = j
+			}
+			j.Reruns++
+			j.Runs += o.runs
+			j.Failures += o.fail
+			if o.pass > 0 && o.fail > 0 {
+				j.FlakyCommits = append(j.FlakyCommits, commit)
+			}
+		}
+	}
+
+	var out []*FlakyJob
+	for _, j := range jobs {
+		if len(j.FlakyCommits) > 0 {
+			sort.Strings(j.FlakyCommits)
+			out = append(out, j)
+		}
+	}
+	sort.Sort(byFlakiness(out))
+	return out
+}
+
+// ForProject fetches the build history of a project and analyzes it. Builds
+// of re-run commits are fetched in full to get their jobs, and with
+// opt.Tests their logs are parsed to find flaky tests.
+func ForProject(c kciClient.Client, projId int64, opt *Options) (*Report, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+	builds, err := c.BuildList(projId)
+	if err != nil {
+		return nil, err
+	}
+	reruns := rerunCommits(builds)
+	for _, bs := range reruns {
+		for _, b := range bs {
+			if len(b.Jobs) > 0 {
+				continue
+			}
+			full, err := c.BuildById(projId, b.Number)
+			if err != nil {
+				return nil, err
+			}
+			b.Jobs = full.Jobs
+		}
+	}
+	r := Analyze(builds)
+	r.ProjectId = projId
+	if opt.Tests {
+		r.FlakyTests, err = flakyTests(c, projId, reruns)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func flakyTests(c kciClient.Client, projId int64, reruns map[string][]*kciClient.Build) ([]*FlakyTest, error) {
+	tests := map[string]*FlakyTest{}
+	for commit, bs := range reruns {
+		type outcome struct{ pass, fail int }
+		outcomes := map[string]*outcome{}
+		for _, b := range bs {
+			for _, job := range b.Jobs {
+				report, err := testreport.FromJob(c, projId, b.Number, job.Number, nil)
+				if err != nil {
+					return nil, err
+				}
+				for _, p := range report.Packages {
+					for _, t := range p.Tests {
+						key := p.Name + "\x00" + t.Name
+						o := outcomes[key]
+						if o == nil {
+							o = new(outcome)
+							outcomes[key] = o
+						}
+						switch t.Status {
+						case testreport.Pass:
+							o.pass++
+						case testreport.Fail:
+							o.fail++
+						}
+						if tests[key] == nil {
+							tests[key] = &FlakyTest{Package: p.Name, Name: t.Name}
+						}
+					}
+				}
+			}
+		}
+		for key, o := range outcomes {
+			t := tests[key]
+			t.Passed += o.pass
+			t.Failures += o.fail
+			if o.pass > 0 && o.fail > 0 {
+				t.Commits = append(t.Commits, commit)
+			}
+		}
+	}
+
+	var out []*FlakyTest
+	for _, t := range tests {
+		if len(t.Commits) > 0 {
+			sort.Strings(t.Commits)
+			out = append(out, t)
+		}
+	}
+	sort.Sort(byFlakyCommits(out))
+	return out, nil
+}
+
+type byNumber []*kciClient.Build
+
+func (p byNumber) Len() int           { return len(p) }
+func (p byNumber) Less(i, j int) bool { return p[i].Number < p[j].Number }
+func (p byNumber) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type byFailureRate []*BranchStats
+
+func (p byFailureRate) Len() int      { return len(p) }
+func (p byFailureRate) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byFailureRate) Less(i, j int) bool {
+	if p[i].FailureRate != p[j].FailureRate {
+		return p[i].FailureRate > p[j].FailureRate
+	}
+	return p[i].Branch < p[j].Branch
+}
+
+type byFlakiness []*FlakyJob
+
+func (p byFlakiness) Len() int      { return len(p) }
+func (p byFlakiness) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byFlakiness) Less(i, j int) bool {
+	if len(p[i].FlakyCommits) != len(p[j].FlakyCommits) {
+		return len(p[i].FlakyCommits) > len(p[j].FlakyCommits)
+	}
+	if p[i].Score() != p[j].Score() {
+		return p[i].Score() > p[j].Score()
+	}
+	return p[i].JobNum < p[j].JobNum
+}
+
+type byFlakyCommits []*FlakyTest
+
+func (p byFlakyCommits) Len() int      { return len(p) }
+func (p byFlakyCommits) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byFlakyCommits) Less(i, j int) bool {
+	if len(p[i].Commits) != len(p[j].Commits) {
+		return len(p[i].Commits) > len(p[j].Commits)
+	}
+	if p[i].Package != p[j].Package {
+		return p[i].Package < p[j].Package
+	}
+	return p[i].Name < p[j].Name
+}
@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func build(num int, branch, status string, min int) *kciClient.Build {
+	return &kciClient.Build{Number: num, Branch: branch, Status: status, Finished: t0.Add(time.Duration(min) * time.Minute)}
+}
+
+func TestBranchStats(t *testing.T) {
+	const (
+		ok   = kciClient.StatusSuccess
+		fail = kciClient.StatusFailure
+	)
+	tests := []struct {
+		name   string
+		builds []*kciClient.Build
+		want   BranchStats
+	}{
+		{"all pass", []*kciClient.Build{build(1, "m", ok, 0), build(2, "m", ok, 1)},
+			BranchStats{Branch: "m", Builds: 2}},
+		{"flip", []*kciClient.Build{build(1, "m", ok, 0), build(2, "m", fail, 10), build(3, "m", fail, 20), build(4, "m", ok, 40)},
+			BranchStats{Branch: "m", Builds: 4, Failures: 2, FailureRate: 0.5, Flips: 1, Recoveries: 1, MTTR: 30 * time.Minute}},
+		{"failing from start", []*kciClient.Build{build(2, "m", ok, 20), build(1, "m", kciClient.StatusError, 0)},
+			BranchStats{Branch: "m", Builds: 2, Failures: 1, FailureRate: 0.5, Recoveries: 1, MTTR: 20 * time.Minute}},
+		{"still failing", []*kciClient.Build{build(1, "m", ok, 0), build(2, "m", fail, 10)},
+			BranchStats{Branch: "m", Builds: 2, Failures: 1, FailureRate: 0.5}},
+		{"unfinished ignored", []*kciClient.Build{build(1, "m", ok, 0), build(2, "m", kciClient.StatusRunning, 0), build(3, "m", kciClient.StatusKilled, 0)},
+			BranchStats{Branch: "m", Builds: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Analyze(tt.builds)
+			if len(r.Branches) != 1 {
+				t.Fatalf("got %d branches", len(r.Branches))
+			}
+			if got := *r.Branches[0]; got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func withJobs(b *kciClient.Build, commit string, statuses ...string) *kciClient.Build {
+	b.Commit = commit
+	for i, s := range statuses {
+		b.Jobs = append(b.Jobs, &kciClient.Job{Number: i + 1, Status: s})
+	}
+	return b
+}
+
+func TestFlakyJobs(t *testing.T) {
+	const (
+		ok   = kciClient.StatusSuccess
+		fail = kciClient.StatusFailure
+	)
+	builds := []*kciClient.Build{
+		withJobs(build(1, "m", fail, 0), "a", ok, fail),
+		withJobs(build(2, "m", ok, 1), "a", ok, ok),
+		withJobs(build(3, "m", fail, 2), "b", fail, fail),
+		withJobs(build(4, "m", ok, 3), "b", ok, fail),
+		withJobs(build(5, "m", ok, 4), "c", ok, ok),
+	}
+	r := Analyze(builds)
+	if r.Builds != 5 || r.Failures != 2 {
+		t.Errorf("builds %d failures %d", r.Builds, r.Failures)
+	}
+	want := []FlakyJob{
+		{JobNum: 1, Reruns: 2, FlakyCommits: []string{"b"}, Runs: 4, Failures: 1},
+		{JobNum: 2, Reruns: 2, FlakyCommits: []string{"a"}, Runs: 4, Failures: 3},
+	}
+	if len(r.FlakyJobs) != len(want) {
+		t.Fatalf("got %d flaky jobs, want %d", len(r.FlakyJobs), len(want))
+	}
+	for i, w := range want {
+		got := r.FlakyJobs[i]
+		if got.JobNum != w.JobNum || got.Reruns != w.Reruns || got.Runs != w.Runs ||
+			got.Failures != w.Failures || len(got.FlakyCommits) != 1 || got.FlakyCommits[0] != w.FlakyCommits[0] {
+			t.Errorf("job %d: got %+v, want %+v", i, *got, w)
+		}
+		if got.Score() != 0.5 {
+			t.Errorf("job %d: score %v", i, got.Score())
+		}
+	}
+}
+
+func TestForProjectTests(t *testing.T) {
+	m := kciClient.NewMockClient()
+	m.BuildListFunc = func(projId int64) ([]*kciClient.Build, error) {
+		return []*kciClient.Build{
+			{Number: 1, Commit: "a", Status: kciClient.StatusFailure},
+			{Number: 2, Commit: "a", Status: kciClient.StatusSuccess},
+			{Number: 3, Commit: "b", Status: kciClient.StatusSuccess},
+		}, nil
+	}
+	m.BuildByIdFunc = func(projId int64, buildNum int) (*kciClient.Build, error) {
+		if buildNum == 3 {
+			t.Error("fetched build 3, which was not re-run")
+		}
+		return &kciClient.Build{Number: buildNum, Jobs: []*kciClient.Job{{Number: 1, Status: kciClient.StatusSuccess}}}, nil
+	}
+	m.BuildLogsFunc = func(projId int64, buildNum, jobNum int) ([]*kciClient.Log, error) {
+		result := "--- PASS: TestX (0.00s)\n"
+		if buildNum == 1 {
+			result = "--- FAIL: TestX (0.00s)\n"
+		}
+		return []*kciClient.Log{
+			{Proc: "test", Out: "=== RUN   TestX\n"},
+			{Proc: "test", Out: result},
+			{Proc: "test", Out: "--- PASS: TestY (0.00s)\n"},
+			{Proc: "test", Out: "ok  \texample.com/x\t0.01s\n"},
+		}, nil
+	}
+	r, err := ForProject(m, 9, &Options{Tests: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ProjectId != 9 || len(r.FlakyTests) != 1 {
+		t.Fatalf("got %+v", r)
+	}
+	ft := r.FlakyTests[0]
+	if ft.Package != "example.com/x" || ft.Name != "TestX" || ft.Passed != 1 || ft.Failures != 1 || len(ft.Commits) != 1 {
+		t.Errorf("got %+v", *ft)
+	}
+}
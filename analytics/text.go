@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteText writes r as a human readable report.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "project %d: %d builds, %d failed (%.1f%%)\n\n",
+		r.ProjectId, r.Builds, r.Failures, 100*r.FailureRate)
+
+	fmt.Fprintln(tw, "BRANCH\tBUILDS\tFAILED\tRATE\tFLIPS\tMTTR")
+	for _, b := range r.Branches {
+		mttr := "-"
+		if b.Recoveries > 0 {
+			mttr = b.MTTR.Truncate(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%d\t%s\n",
+			b.Branch, b.Builds, b.Failures, 100*b.FailureRate, b.Flips, mttr)
+	}
+
+	if len(r.FlakyJobs) > 0 {
+		fmt.Fprintln(tw, "\nJOB\tFLAKY COMMITS\tRE-RUN COMMITS\tRUNS\tFAILED")
+		for _, j := range r.FlakyJobs {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\n",
+				j.JobNum, len(j.FlakyCommits), j.Reruns, j.Runs, j.Failures)
+		}
+	}
+
+	if len(r.FlakyTests) > 0 {
+		fmt.Fprintln(tw, "\nTEST\tFLAKY COMMITS\tPASSED\tFAILED")
+		for _, t := range r.FlakyTests {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n",
+				strings.TrimPrefix(t.Package+"."+t.Name, "."), len(t.Commits), t.Passed, t.Failures)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,149 @@
+// Package badge renders shields style SVG badges with the status of the
+// latest build of a project branch, for READMEs:
+//
+//	http.Handle("/badge/", badge.NewHandler(client))
+//	// <img src="https://ci.example.com/badge/42/master.svg">
+package badge
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// colors of the message part
+const (
+	Green  = "#4c1"
+	Red    = "#e05d44"
+	Yellow = "#dfb317"
+	Grey   = "#9f9f9f"
+)
+
+// Badge is a label and a message on a colored background.
+type Badge struct {
+	Label   string
+	Message string
+	Color   string // of the message
+}
+
+// Latest returns the newest finished build of branch, or the newest build if
+// none finished yet. It returns nil if the branch has no builds.
+func Latest(c kciClient.Client, projId int64, branch string) (*kciClient.Build, error) {
+	builds, err := c.BuildList(projId)
+	if err != nil {
+		return nil, err
+	}
+	var newest, done *kciClient.Build
+	for _, b := range builds {
+		if b.Branch != branch {
+			continue
+		}
+		if newest == nil || b.Number > newest.Number {
+			newest = b
+		}
+		if kciClient.IsDone(b.Status) && (done == nil || b.Number > done.Number) {
+			done = b
+		}
+	}
+	if done != nil {
+		return done, nil
+	}
+	return newest, nil
+}
+
+// ForBuild returns the badge of b, nil meaning no build. With duration set
+// the message of a finished build is its duration instead of its status.
+func ForBuild(label string, b *kciClient.Build, duration bool) *Badge {
+	badge := &Badge{Label: label, Message: "unknown", Color: Grey}
+	if b == nil {
+		return badge
+	}
+	switch b.Status {
+	case kciClient.StatusSuccess:
+		badge.Message, badge.Color = "passing", Green
+	case kciClient.StatusFailure:
+		badge.Message, badge.Color = "failing", Red
+	case kciClient.StatusError:
+		badge.Message, badge.Color = "error", Red
+	case kciClient.StatusRunning, kciClient.StatusPending:
+		badge.Message, badge.Color = b.Status, Yellow
+	case "":
+	default:
+		badge.Message = b.Status
+	}
+	if duration && kciClient.IsDone(b.Status) && b.Finished.After(b.Started) && !b.Started.IsZero() {
+		badge.Message = formatDuration(b.Finished.Sub(b.Started))
+	}
+	return badge
+}
+
+// formatDuration formats d like 45s, 3m 10s or 1h 5m.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh %dm", h, m)
+	case m > 0:
+		return fmt.Sprintf("%dm %ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+// ---------------------------------------------------------------------------------------
+
+var svg = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Label}}: {{.Message}}">
+<title>{{.Label}}: {{.Message}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="{{.LabelWidth}}" height="20" fill="#555"/>
+<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/>
+<rect width="{{.Width}}" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{.Label}}</text>
+<text x="{{.LabelX}}" y="14">{{.Label}}</text>
+<text x="{{.MessageX}}" y="15" fill="#010101" fill-opacity=".3">{{.Message}}</text>
+<text x="{{.MessageX}}" y="14">{{.Message}}</text>
+</g>
+</svg>
+`))
+
+// SVG renders the badge.
+func (b *Badge) SVG() []byte {
+	lw, mw := textWidth(b.Label)+10, textWidth(b.Message)+10
+	data := struct {
+		*Badge
+		Width, LabelWidth, MessageWidth int
+		LabelX, MessageX                float64
+	}{b, lw + mw, lw, mw, float64(lw) / 2, float64(lw) + float64(mw)/2}
+	var buf bytes.Buffer
+	svg.Execute(&buf, data)
+	return buf.Bytes()
+}
+
+// textWidth estimates the width in pixels of s in 11px Verdana.
+func textWidth(s string) int {
+	w := 0.0
+	for _, r := range s {
+		switch {
+		case r == ' ' || r == 'i' || r == 'l' || r == 'j' || r == '.' || r == ',' || r == ':' || r == '|' || r == '!':
+			w += 3.5
+		case r == 'f' || r == 't' || r == 'r' || r == 'I' || r == '-' || r == '(' || r == ')':
+			w += 4.5
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W':
+			w += 10
+		case r >= 'A' && r <= 'Z':
+			w += 7.5
+		case r < 0x80:
+			w += 6.5
+		default:
+			w += 11
+		}
+	}
+	return int(w + 0.5)
+}
@@ -0,0 +1,196 @@
+package badge
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func TestForBuild(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		build    *kciClient.Build
+		duration bool
+		message  string
+		color    string
+	}{
+		{"no build", nil, false, "unknown", Grey},
+		{"success", &kciClient.Build{Status: kciClient.StatusSuccess}, false, "passing", Green},
+		{"failure", &kciClient.Build{Status: kciClient.StatusFailure}, false, "failing", Red},
+		{"error", &kciClient.Build{Status: kciClient.StatusError}, false, "error", Red},
+		{"running", &kciClient.Build{Status: kciClient.StatusRunning}, false, "running", Yellow},
+		{"killed", &kciClient.Build{Status: kciClient.StatusKilled}, false, "killed", Grey},
+		{"duration", &kciClient.Build{Status: kciClient.StatusSuccess, Started: start, Finished: start.Add(190 * time.Second)}, true, "3m 10s", Green},
+		{"duration while running", &kciClient.Build{Status: kciClient.StatusRunning, Started: start}, true, "running", Yellow},
+	}
+	for _, tt := range tests {
+		b := ForBuild("build", tt.build, tt.duration)
+		if b.Message != tt.message || b.Color != tt.color {
+			t.Errorf("%s: got %s %s, want %s %s", tt.name, b.Message, b.Color, tt.message, tt.color)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{45 * time.Second, "45s"},
+		{1500 * time.Millisecond, "2s"},
+		{190 * time.Second, "3m 10s"},
+		{65 * time.Minute, "1h 5m"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+var testBuilds = []*kciClient.Build{
+	{Number: 1, Branch: "master", Status: kciClient.StatusSuccess},
+	{Number: 2, Branch: "master", Status: kciClient.StatusFailure},
+	{Number: 3, Branch: "master", Status: kciClient.StatusRunning},
+	{Number: 4, Branch: "dev", Status: kciClient.StatusPending},
+}
+
+func TestLatest(t *testing.T) {
+	m := kciClient.NewMockClient()
+	m.BuildListFunc = func(projId int64) ([]*kciClient.Build, error) { return testBuilds, nil }
+	tests := []struct {
+		branch string
+		want   int // build number, 0 for none
+	}{
+		{"master", 2}, // newest finished
+		{"dev", 4},    // nothing finished, newest
+		{"other", 0},
+	}
+	for _, tt := range tests {
+		b, err := Latest(m, 1, tt.branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		if b != nil {
+			got = b.Number
+		}
+		if got != tt.want {
+			t.Errorf("%s: got #%d, want #%d", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func testClient() *kciClient.MockClient {
+	m := kciClient.NewMockClient()
+	m.ProjListFunc = func() ([]*kciClient.Project, error) {
+		return []*kciClient.Project{{ID: 42, ProjName: "api"}}, nil
+	}
+	m.BuildListFunc = func(projId int64) ([]*kciClient.Build, error) {
+		if projId != 42 {
+			return nil, errors.New("no such project")
+		}
+		return testBuilds, nil
+	}
+	return m
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		path    string
+		code    int
+		message string // in the svg
+		cache   string
+	}{
+		{"/badge/42/master.svg", 200, "failing", "max-age=60"},
+		{"/badge/api/master.svg", 200, "failing", "max-age=60"},
+		{"/badge/api/dev.svg", 200, "pending", "max-age=60"},
+		{"/badge/api/feature/x.svg", 200, "unknown", "max-age=60"},
+		{"/badge/7/master.svg", 200, "unknown", "max-age=10"}, // lookup failed
+		{"/badge/web/master.svg", 200, "unknown", "max-age=10"},
+		{"/badge/api.svg", 404, "", ""},
+		{"/badge/api/master.png", 404, "", ""},
+		{"/other/api/master.svg", 404, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var errs int
+			h := NewHandler(testClient())
+			h.OnError = func(err error) { errs++ }
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.code {
+				t.Fatalf("got %d, want %d", w.Code, tt.code)
+			}
+			if tt.code != 200 {
+				return
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.cache {
+				t.Errorf("Cache-Control %q, want %q", got, tt.cache)
+			}
+			if !strings.Contains(w.Body.String(), ">"+tt.message+"<") {
+				t.Errorf("badge lacks %q:\n%s", tt.message, w.Body.String())
+			}
+			if failed := tt.cache == "max-age=10"; failed != (errs > 0) {
+				t.Errorf("%d errors reported", errs)
+			}
+		})
+	}
+}
+
+func TestHandlerCaching(t *testing.T) {
+	m := testClient()
+	h := NewHandler(m)
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	first := get("/badge/api/master.svg", "")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if w := get("/badge/api/master.svg", etag); w.Code != 304 {
+		t.Errorf("revalidation got %d, want 304", w.Code)
+	}
+	m.AssertNumberOfCalls(t, "BuildList", 1)
+
+	// unknown names list the projects once per TTL
+	for i := 0; i < 3; i++ {
+		get("/badge/web/master.svg", "")
+		get("/badge/docs/master.svg", "")
+	}
+	m.AssertNumberOfCalls(t, "ProjList", 1)
+
+	h.mu.Lock()
+	h.namesAt = time.Now().Add(-2 * h.ttl())
+	h.mu.Unlock()
+	get("/badge/ops/master.svg", "")
+	m.AssertNumberOfCalls(t, "ProjList", 2)
+
+	// failed lookups are cached for ErrorMaxAge, ids included
+	for i := 0; i < 3; i++ {
+		if w := get("/badge/7/master.svg", ""); w.Header().Get("Cache-Control") != "max-age=10" {
+			t.Errorf("Cache-Control %q", w.Header().Get("Cache-Control"))
+		}
+	}
+	m.AssertNumberOfCalls(t, "BuildList", 2)
+	h.mu.Lock()
+	for _, c := range h.cache {
+		c.expires = time.Now().Add(-time.Second)
+	}
+	h.mu.Unlock()
+	get("/badge/7/master.svg", "")
+	m.AssertNumberOfCalls(t, "BuildList", 3)
+}
@@ -0,0 +1,175 @@
+package badge
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Handler serves badges at {Prefix}{proj}/{branch}.svg, where proj is a
+// project id or name and branch may contain slashes. Badges, and the
+// project names, are cached for TTL. The query parameter duration=1 shows
+// build durations instead of statuses.
+type Handler struct {
+	Client kciClient.Client
+	Prefix string        // defaults to /badge/
+	Label  string        // defaults to build
+	TTL    time.Duration // defaults to a minute
+
+	// OnError, if set, is told about failures to look up builds. An
+	// unknown badge is served for them, cached for ErrorMaxAge only; the
+	// requests it serves meanwhile are not reported again.
+	OnError func(err error)
+
+	mu      sync.Mutex
+	cache   map[string]*cached
+	names   map[string]int64 // project ids by name
+	namesAt time.Time        // when names was listed
+}
+
+// ErrorMaxAge is how long the unknown badge served for a failed lookup is
+// cached, by the handler and by clients.
+const ErrorMaxAge = 10 * time.Second
+
+type cached struct {
+	svg     []byte
+	etag    string
+	maxAge  time.Duration
+	expires time.Time
+}
+
+// NewHandler returns a handler serving the badges of the projects of c.
+func NewHandler(c kciClient.Client) *Handler {
+	return &Handler{Client: c}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := h.Prefix
+	if prefix == "" {
+		prefix = "/badge/"
+	}
+	p := strings.TrimPrefix(r.URL.Path, prefix)
+	i := strings.Index(p, "/")
+	if p == r.URL.Path || i <= 0 || !strings.HasSuffix(p, ".svg") || len(p) <= i+len("/.svg") {
+		http.NotFound(w, r)
+		return
+	}
+	proj, branch := p[:i], strings.TrimSuffix(p[i+1:], ".svg")
+	duration := r.URL.Query().Get("duration") == "1"
+
+	c, err := h.badge(proj, branch, duration)
+	if err != nil && h.OnError != nil {
+		h.OnError(err)
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(c.maxAge/time.Second)))
+	w.Header().Set("ETag", c.etag)
+	if r.Header.Get("If-None-Match") == c.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(c.svg)
+}
+
+func (h *Handler) label() string {
+	if h.Label == "" {
+		return "build"
+	}
+	return h.Label
+}
+
+func (h *Handler) ttl() time.Duration {
+	if h.TTL == 0 {
+		return time.Minute
+	}
+	return h.TTL
+}
+
+// badge returns the cached badge, rendering it again once expired. If the
+// lookup fails it returns the unknown badge, cached for ErrorMaxAge, with
+// the error.
+func (h *Handler) badge(proj, branch string, duration bool) (*cached, error) {
+	key := fmt.Sprintf("%s/%s/%t", proj, branch, duration)
+	h.mu.Lock()
+	c, ok := h.cache[key]
+	h.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c, nil
+	}
+
+	b, err := h.latest(proj, branch)
+	var svg []byte
+	maxAge := h.ttl()
+	if err != nil {
+		svg, maxAge = ForBuild(h.label(), nil, false).SVG(), ErrorMaxAge
+	} else {
+		svg = ForBuild(h.label(), b, duration).SVG()
+	}
+	c = &cached{
+		svg:     svg,
+		etag:    fmt.Sprintf(`"%x"`, sha1.Sum(svg)),
+		maxAge:  maxAge,
+		expires: time.Now().Add(maxAge),
+	}
+	h.mu.Lock()
+	if h.cache == nil {
+		h.cache = map[string]*cached{}
+	}
+	// drop expired badges so the cache only holds badges still requested
+	for k, v := range h.cache {
+		if time.Now().After(v.expires) {
+			delete(h.cache, k)
+		}
+	}
+	h.cache[key] = c
+	h.mu.Unlock()
+	return c, err
+}
+
+func (h *Handler) latest(proj, branch string) (*kciClient.Build, error) {
+	id, err := h.projectId(proj)
+	if err != nil {
+		return nil, err
+	}
+	return Latest(h.Client, id, branch)
+}
+
+// projectId resolves a project id or name. The projects are listed again
+// for an unknown name at most once per TTL, so requests for names that do
+// not exist cannot make every request list them.
+func (h *Handler) projectId(proj string) (int64, error) {
+	if id, err := strconv.ParseInt(proj, 10, 64); err == nil {
+		return id, nil
+	}
+	h.mu.Lock()
+	id, ok := h.names[proj]
+	fresh := time.Since(h.namesAt) < h.ttl()
+	h.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	if fresh {
+		return 0, fmt.Errorf("badge: no project %q", proj)
+	}
+	projs, err := h.Client.ProjList()
+	if err != nil {
+		return 0, err
+	}
+	names := map[string]int64{}
+	for _, p := range projs {
+		names[p.ProjName] = p.ID
+	}
+	h.mu.Lock()
+	h.names, h.namesAt = names, time.Now()
+	h.mu.Unlock()
+	if id, ok := names[proj]; ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("badge: no project %q", proj)
+}
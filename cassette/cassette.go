@@ -0,0 +1,113 @@
+// Package cassette records the http and websocket traffic of a kci client to
+// a file and replays it, so code built on kciClient.Client can be tested
+// against realistic responses without the network.
+//
+//	rec, _ := cassette.New("testdata/builds.json", cassette.Replay)
+//	config := &kciClient.ClientConfig{Host: "kci.qiniu.com"}
+//	if err := rec.Configure(config); err != nil { ... }
+//	client := kciClient.NewClientWithConfig(config)
+//	...
+//	rec.Save() // in Record mode
+package cassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Version of the cassette file format.
+const Version = 1
+
+// Mode selects whether a recorder talks to the server or replays a file.
+type Mode int
+
+const (
+	// Record forwards requests to the real transports and records them.
+	Record Mode = iota
+	// Replay serves recorded interactions and never touches the network.
+	Replay
+)
+
+// Body is a request or response body. Bodies that are not valid utf-8 are
+// stored base64 encoded.
+type Body []byte
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var enc map[string]string
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(enc["base64"])
+	*b = raw
+	return err
+}
+
+// Request is a recorded request. Authorization and cookie headers are never
+// stored.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is a recorded response. Set-Cookie headers are never stored.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Interaction is a request and the response it got.
+type Interaction struct {
+	Request  *Request  `json:"request"`
+	Response *Response `json:"response"`
+}
+
+// WsSession is the sequence of messages read from one websocket.
+type WsSession struct {
+	URL      string `json:"url"`
+	Messages []Body `json:"messages"`
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+	Websockets   []*WsSession   `json:"websockets,omitempty"`
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Cassette)
+	err = json.Unmarshal(data, c)
+	return c, err
+}
+
+// Save writes c to path.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,37 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body Body
+		json string
+	}{
+		{"text", Body(`{"a":1}`), `"{\"a\":1}"`},
+		{"empty", Body{}, `""`},
+		{"binary", Body{0xff, 0x00, 0x01}, `{"base64":"/wAB"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.json {
+				t.Errorf("marshal: got %s, want %s", data, tt.json)
+			}
+			var back Body
+			if err := json.Unmarshal(data, &back); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(back, tt.body) {
+				t.Errorf("round trip: got %q, want %q", back, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// headers stripped from requests and responses before an interaction is
+// stored
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Matcher selects which parts of a request must equal the recorded one for
+// it to be replayed.
+type Matcher struct {
+	Method bool
+	Path   bool
+	Query  bool
+	Body   bool
+}
+
+// DefaultMatcher compares everything.
+var DefaultMatcher = Matcher{Method: true, Path: true, Query: true, Body: true}
+
+// Recorder is an http.RoundTripper and kciClient.WsTransport that records or
+// replays a cassette. Recorded interactions are replayed in order: each one
+// serves a single matching request.
+type Recorder struct {
+	Mode  Mode
+	Path  string
+	Match Matcher
+
+	// the real transports used in Record mode, set by Configure. They
+	// default to http.DefaultTransport and kciClient.DefaultWsTransport.
+	Transport   http.RoundTripper
+	WsTransport kciClient.WsTransport
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     map[interface{}]bool
+}
+
+// New returns a recorder for the cassette at path. In Replay mode the file
+// is loaded immediately.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		Mode:     mode,
+		Path:     path,
+		Match:    DefaultMatcher,
+		cassette: &Cassette{Version: Version},
+		used:     map[interface{}]bool{},
+	}
+	if mode == Replay {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+	}
+	return r, nil
+}
+
+// Configure plugs the recorder into config. Transports already set on config
+// become the real transports used when recording; in Record mode, those
+// not set are built from the network settings of config, as the client
+// would. It fails if they cannot be built, e.g. for a missing CA file.
+func (r *Recorder) Configure(config *kciClient.ClientConfig) error {
+	if config.Transport != nil {
+		r.Transport = config.Transport
+	} else if r.Mode == Record && r.Transport == nil {
+		t, err := config.NewHTTPTransport()
+		if err != nil {
+			return err
+		}
+		r.Transport = t
+	}
+	if config.WsTransport != nil {
+		r.WsTransport = config.WsTransport
+	} else if r.Mode == Record && r.WsTransport == nil {
+		t, err := config.NewWsTransport()
+		if err != nil {
+			return err
+		}
+		r.WsTransport = t
+	}
+	config.Transport = r
+	config.WsTransport = r
+	return nil
+}
+
+// Save writes what was recorded to Path.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.Path)
+}
+
+// Cassette returns the cassette being recorded or replayed.
+func (r *Recorder) Cassette() *Cassette {
+	return r.cassette
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if r.Mode == Replay {
+		return r.replay(req, body)
+	}
+	return r.record(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request:  &Request{Method: req.Method, URL: req.URL.String(), Header: publicHeader(req.Header), Body: body},
+		Response: &Response{Status: resp.StatusCode, Header: publicHeader(resp.Header), Body: respBody},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, it := range r.cassette.Interactions {
+		if r.used[it] || !r.matches(it.Request, req, body) {
+			continue
+		}
+		r.used[it] = true
+		resp := &http.Response{
+			Status:        fmt.Sprintf("%d %s", it.Response.Status, http.StatusText(it.Response.Status)),
+			StatusCode:    it.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        cloneHeader(it.Response.Header),
+			Body:          ioutil.NopCloser(bytes.NewReader(it.Response.Body)),
+			ContentLength: int64(len(it.Response.Body)),
+			Request:       req,
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("cassette: no recorded interaction for %s %s", req.Method, req.URL)
+}
+
+func (r *Recorder) matches(rec *Request, req *http.Request, body []byte) bool {
+	if r.Match.Method && rec.Method != req.Method {
+		return false
+	}
+	u, err := url.Parse(rec.URL)
+	if err != nil {
+		return false
+	}
+	if r.Match.Path && u.Path != req.URL.Path {
+		return false
+	}
+	if r.Match.Query && u.RawQuery != req.URL.RawQuery {
+		return false
+	}
+	if r.Match.Body && !bytes.Equal(rec.Body, body) {
+		return false
+	}
+	return true
+}
+
+// Dial implements kciClient.WsTransport. When recording, messages are
+// appended to the cassette as they arrive; when replaying, the messages of
+// the first unused session with the same path and query are sent and the
+// channel is closed.
+func (r *Recorder) Dial(uri string, header http.Header) (<-chan []byte, error) {
+	if r.Mode == Replay {
+		return r.replayWs(uri)
+	}
+	transport := r.WsTransport
+	if transport == nil {
+		transport = kciClient.DefaultWsTransport
+	}
+	in, err := transport.Dial(uri, header)
+	if err != nil {
+		return nil, err
+	}
+	session := &WsSession{URL: uri}
+	r.mu.Lock()
+	r.cassette.Websockets = append(r.cassette.Websockets, session)
+	r.mu.Unlock()
+
+	out := make(chan []byte, 10)
+	go func() {
+		defer close(out)
+		for msg := range in {
+			r.mu.Lock()
+			session.Messages = append(session.Messages, Body(msg))
+			r.mu.Unlock()
+			out <- msg
+		}
+	}()
+	return out, nil
+}
+
+func (r *Recorder) replayWs(uri string) (<-chan []byte, error) {
+	want, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.cassette.Websockets {
+		u, err := url.Parse(s.URL)
+		if err != nil || r.used[s] || u.Path != want.Path || (r.Match.Query && u.RawQuery != want.RawQuery) {
+			continue
+		}
+		r.used[s] = true
+		out := make(chan []byte, len(s.Messages))
+		for _, msg := range s.Messages {
+			out <- []byte(msg)
+		}
+		close(out)
+		return out, nil
+	}
+	return nil, fmt.Errorf("cassette: no recorded websocket for %s", uri)
+}
+
+// publicHeader returns a copy of h without secretHeaders.
+func publicHeader(h http.Header) http.Header {
+	out := cloneHeader(h)
+	for _, k := range secretHeaders {
+		out.Del(k)
+	}
+	return out
+}
+
+func cloneHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
@@ -0,0 +1,196 @@
+package cassette
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// fakeWs is a WsTransport whose connections yield msgs and then end.
+type fakeWs struct {
+	msgs []string
+}
+
+func (f *fakeWs) Dial(uri string, header http.Header) (<-chan []byte, error) {
+	ch := make(chan []byte, len(f.msgs))
+	for _, m := range f.msgs {
+		ch <- []byte(m)
+	}
+	close(ch)
+	return ch, nil
+}
+
+func tempPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "cassette.json")
+}
+
+func config(host string) *kciClient.ClientConfig {
+	return &kciClient.ClientConfig{Host: host, Scheme: "http", AK: "ak", SK: "sk", APIVersion: "v1"}
+}
+
+func TestRecordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("X-Reqid", "abc")
+		if r.Method == "POST" {
+			b, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, `{"id":%d,"name":"created"}`, len(b))
+			return
+		}
+		fmt.Fprintf(w, `{"id":%s,"name":"p%s"}`, r.URL.Path[len("/v1/project/"):], r.URL.Path[len("/v1/project/"):])
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	path := tempPath(t)
+
+	rec, err := New(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config(host)
+	cfg.WsTransport = &fakeWs{msgs: []string{"m1", "m2"}}
+	if err := rec.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.Transport.(*http.Transport); !ok {
+		t.Errorf("record transport %T, want one built from the config", rec.Transport)
+	}
+	c := kciClient.NewClientWithConfig(cfg)
+	for _, id := range []int64{1, 2} {
+		if _, err := c.Proj(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.ProjPost(&kciClient.CreateProjReq{ProjName: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := c.LogWs(1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range msgs {
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	for _, secret := range []string{"Qiniu ak:", "Set-Cookie", "session"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+	if !strings.Contains(string(data), "X-Reqid") {
+		t.Error("cassette lacks response headers")
+	}
+
+	ts.Close()
+	rec, err = New(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = config(host)
+	if err := rec.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	c = kciClient.NewClientWithConfig(cfg)
+	tests := []struct {
+		id      int64
+		want    string
+		wantErr bool
+	}{
+		{2, "p2", false},
+		{1, "p1", false},
+		{1, "", true}, // each interaction is replayed once
+		{3, "", true},
+	}
+	for _, tt := range tests {
+		p, err := c.Proj(tt.id)
+		if (err != nil) != tt.wantErr || (err == nil && p.ProjName != tt.want) {
+			t.Errorf("Proj(%d) = %+v, %v", tt.id, p, err)
+		}
+	}
+	if _, err := c.ProjPost(&kciClient.CreateProjReq{ProjName: "y"}); err == nil {
+		t.Error("post with another body replayed")
+	}
+	if p, err := c.ProjPost(&kciClient.CreateProjReq{ProjName: "x"}); err != nil || p.ProjName != "created" {
+		t.Errorf("post: %+v, %v", p, err)
+	}
+	msgs, err = c.LogWs(1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for m := range msgs {
+		got = append(got, string(m))
+	}
+	if fmt.Sprint(got) != "[m1 m2]" {
+		t.Errorf("replayed messages %q", got)
+	}
+	if _, err := c.LogWs(1, 2, 3); err == nil {
+		t.Error("websocket replayed twice")
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	rec := &Request{Method: "GET", URL: "http://h/v1/build/1?job=2", Body: Body("b")}
+	tests := []struct {
+		name    string
+		match   Matcher
+		method  string
+		url     string
+		body    string
+		matches bool
+	}{
+		{"same", DefaultMatcher, "GET", "http://other/v1/build/1?job=2", "b", true},
+		{"method", DefaultMatcher, "POST", "http://h/v1/build/1?job=2", "b", false},
+		{"path", DefaultMatcher, "GET", "http://h/v1/build/2?job=2", "b", false},
+		{"query", DefaultMatcher, "GET", "http://h/v1/build/1?job=3", "b", false},
+		{"query ignored", Matcher{Method: true, Path: true}, "GET", "http://h/v1/build/1", "x", true},
+		{"body", DefaultMatcher, "GET", "http://h/v1/build/1?job=2", "c", false},
+	}
+	for _, tt := range tests {
+		r := &Recorder{Match: tt.match}
+		req, _ := http.NewRequest(tt.method, tt.url, nil)
+		if got := r.matches(rec, req, []byte(tt.body)); got != tt.matches {
+			t.Errorf("%s: matches = %v", tt.name, got)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    Mode
+		cfg     kciClient.ClientConfig
+		wantErr bool
+	}{
+		{"record bad ca", Record, kciClient.ClientConfig{Host: "h", CAFile: "/nonexistent"}, true},
+		{"replay ignores network settings", Replay, kciClient.ClientConfig{Host: "h", CAFile: "/nonexistent"}, false},
+		{"record with transport", Record, kciClient.ClientConfig{Host: "h", CAFile: "/nonexistent",
+			Transport: http.DefaultTransport, WsTransport: kciClient.DefaultWsTransport}, false},
+	}
+	for _, tt := range tests {
+		r := &Recorder{Mode: tt.mode, cassette: &Cassette{}, used: map[interface{}]bool{}}
+		cfg := tt.cfg
+		err := r.Configure(&cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+		if err == nil && (cfg.Transport != r || cfg.WsTransport != r) {
+			t.Errorf("%s: recorder not plugged in", tt.name)
+		}
+	}
+}
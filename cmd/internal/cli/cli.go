@@ -0,0 +1,76 @@
+// Package cli holds the connection flags shared by the kci commands.
+package cli
+
+import (
+	"flag"
+	"os"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Flags select the context to connect with. Host, AK and SK override the
+// values of the context.
+type Flags struct {
+	Config  string
+	Context string
+	Host    string
+	AK      string
+	SK      string
+}
+
+// Register adds the connection flags to fs.
+func Register(fs *flag.FlagSet) *Flags {
+	f := new(Flags)
+	fs.StringVar(&f.Config, "config", "", "context registry, defaults to $KCI_CONFIG or ~/.kci/config.yml")
+	fs.StringVar(&f.Context, "context", "", "context to use, defaults to $KCI_CONTEXT or the current context")
+	fs.StringVar(&f.Host, "host", "", "kci host, overrides the context")
+	fs.StringVar(&f.AK, "ak", "", "access key, overrides the context, defaults to $KCI_AK")
+	fs.StringVar(&f.SK, "sk", "", "secret key, overrides the context, defaults to $KCI_SK")
+	return f
+}
+
+// Resolve resolves the flags into a context. Without a registry the context
+// is built from the flags and $KCI_AK/$KCI_SK alone. When -host, -ak and -sk
+// are all given, a current context that is missing is ignored; one named by
+// -context or $KCI_CONTEXT is still required.
+func (f *Flags) Resolve() (*kciClient.Context, error) {
+	reg, err := kciClient.LoadRegistry(f.Config)
+	if err != nil {
+		return nil, err
+	}
+	ctx := new(kciClient.Context)
+	if len(reg.Contexts) > 0 || f.Context != "" {
+		c, err := reg.Context(f.Context)
+		switch {
+		case err == nil:
+			*ctx = *c
+		case f.Context != "" || os.Getenv("KCI_CONTEXT") != "" || f.Host == "" || f.AK == "" || f.SK == "":
+			return nil, err
+		}
+	}
+	if f.Host != "" {
+		ctx.Host = f.Host
+	}
+	if f.AK != "" {
+		ctx.AK = f.AK
+	}
+	if f.SK != "" {
+		ctx.SK = f.SK
+	}
+	if ctx.AK == "" {
+		ctx.AK = os.Getenv("KCI_AK")
+	}
+	if ctx.SK == "" {
+		ctx.SK = os.Getenv("KCI_SK")
+	}
+	return ctx, nil
+}
+
+// Client returns a client for the resolved context.
+func (f *Flags) Client() (kciClient.Client, error) {
+	ctx, err := f.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	return kciClient.NewClientWithConfig(ctx.Config()), nil
+}
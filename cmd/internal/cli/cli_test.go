@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	reg, err := kciClient.LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Contexts["prod"] = &kciClient.Context{Host: "prod.example.com", AK: "pak", SK: "psk", RepoType: "gitlab"}
+	reg.Current = "deleted"
+	if err := reg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("KCI_CONTEXT", os.Getenv("KCI_CONTEXT"))
+	os.Setenv("KCI_CONTEXT", "")
+
+	tests := []struct {
+		name  string
+		flags Flags
+		host  string // "" for an error
+		ak    string
+	}{
+		{"named", Flags{Context: "prod"}, "prod.example.com", "pak"},
+		{"named with override", Flags{Context: "prod", AK: "other"}, "prod.example.com", "other"},
+		{"current deleted", Flags{}, "", ""},
+		{"current deleted, partial flags", Flags{Host: "h", AK: "a"}, "", ""},
+		{"current deleted, full flags", Flags{Host: "h", AK: "a", SK: "s"}, "h", "a"},
+		{"named missing, full flags", Flags{Context: "gone", Host: "h", AK: "a", SK: "s"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flags.Config = path
+			ctx, err := tt.flags.Resolve()
+			if tt.host == "" {
+				if err == nil {
+					t.Errorf("got %+v, want an error", ctx)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ctx.Host != tt.host || ctx.AK != tt.ak {
+				t.Errorf("got host %s, ak %s", ctx.Host, ctx.AK)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Command kci-exporter serves Prometheus metrics about kci projects and builds.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/cmd/internal/cli"
+	"github.com/u2takey/kci-sdk-go/exporter"
+)
+
+func main() {
+	conn := cli.Register(flag.CommandLine)
+	var (
+		listen   = flag.String("listen", ":9358", "address to serve /metrics on")
+		interval = flag.Duration("interval", time.Minute, "poll interval")
+		feed     = flag.Bool("feed", true, "follow the build feed for live updates")
+	)
+	flag.Parse()
+
+	client, err := conn.Client()
+	if err != nil {
+		log.Fatal(err)
+	}
+	e := exporter.New(client)
+	e.Interval = *interval
+	e.OnError = func(err error) { log.Print(err) }
+
+	stop := make(chan struct{})
+	go e.Run(stop)
+	if *feed {
+		users, err := client.Self()
+		if err != nil || len(users) == 0 {
+			fmt.Fprintln(os.Stderr, "kci-exporter: cannot follow feed, no user:", err)
+		} else {
+			go e.Listen(users[0].KUserId, stop)
+		}
+	}
+
+	http.Handle("/metrics", e)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
@@ -0,0 +1,69 @@
+// Command kci-flaky prints build stability reports for kci projects.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/u2takey/kci-sdk-go/analytics"
+	"github.com/u2takey/kci-sdk-go/cmd/internal/cli"
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func main() {
+	conn := cli.Register(flag.CommandLine)
+	var (
+		projs = flag.String("proj", "", "comma separated project ids, all projects if empty")
+		tests = flag.Bool("tests", false, "parse logs of re-run commits to find flaky tests")
+	)
+	flag.Parse()
+
+	client, err := conn.Client()
+	if err != nil {
+		fatal(err)
+	}
+	ids, err := projectIds(client, *projs)
+	if err != nil {
+		fatal(err)
+	}
+	for i, id := range ids {
+		r, err := analytics.ForProject(client, id, &analytics.Options{Tests: *tests})
+		if err != nil {
+			fatal(err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		r.WriteText(os.Stdout)
+	}
+}
+
+func projectIds(client kciClient.Client, list string) ([]int64, error) {
+	var ids []int64
+	if list == "" {
+		projs, err := client.ProjList()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range projs {
+			ids = append(ids, p.ID)
+		}
+		return ids, nil
+	}
+	for _, s := range strings.Split(list, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad project id %q", s)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "kci-flaky:", err)
+	os.Exit(1)
+}
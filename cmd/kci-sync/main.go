@@ -0,0 +1,48 @@
+// Command kci-sync makes the projects of a kci account match a YAML spec.
+// Without -apply it only prints the plan.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/u2takey/kci-sdk-go/cmd/internal/cli"
+	"github.com/u2takey/kci-sdk-go/projsync"
+)
+
+func main() {
+	conn := cli.Register(flag.CommandLine)
+	var (
+		file  = flag.String("f", "kci-projects.yml", "projects spec")
+		apply = flag.Bool("apply", false, "apply the plan")
+		prune = flag.Bool("prune", false, "delete projects missing from the spec")
+	)
+	flag.Parse()
+
+	spec, err := projsync.LoadSpec(*file)
+	if err != nil {
+		fatal(err)
+	}
+	client, err := conn.Client()
+	if err != nil {
+		fatal(err)
+	}
+	plan, err := projsync.MakePlan(client, spec, *prune)
+	if err != nil {
+		fatal(err)
+	}
+	plan.WriteText(os.Stdout)
+	if !*apply || plan.Empty() {
+		return
+	}
+	if err := projsync.Apply(client, plan); err != nil {
+		fatal(err)
+	}
+	fmt.Println("applied")
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "kci-sync:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/u2takey/kci-sdk-go/cmd/internal/cli"
+	"github.com/u2takey/kci-sdk-go/gitremote"
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func buildCmd(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	conn := cli.Register(fs)
+	var (
+		dir    = fs.String("C", ".", "git checkout to resolve the project from")
+		branch = fs.String("branch", "", "branch to build, defaults to the branch checked out")
+	)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 || pos[0] != "start" {
+		return errors.New("build: usage: kci build start [-C dir] [-branch name]")
+	}
+
+	ctx, err := conn.Resolve()
+	if err != nil {
+		return err
+	}
+	client := kciClient.NewClientWithConfig(ctx.Config())
+	res, err := gitremote.Resolve(client, *dir, ctx.RepoType)
+	if err != nil && !(err == gitremote.ErrDetached && *branch != "") {
+		return err
+	}
+	if *branch != "" {
+		res.Branch = *branch
+	}
+	b, err := client.BuildPost(res.Project.ID, res.Branch)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("started %s #%d on %s\n", res.Project.ProjName, b.Number, res.Branch)
+	if b.LinkUrl != "" {
+		fmt.Println(b.LinkUrl)
+	}
+	return nil
+}
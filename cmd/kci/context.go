@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func contextCmd(args []string) error {
+	fs := flag.NewFlagSet("context", flag.ExitOnError)
+	var (
+		config    = fs.String("config", "", "context registry, defaults to $KCI_CONFIG or ~/.kci/config.yml")
+		host      = fs.String("host", "", "kci host")
+		baseURL   = fs.String("base-url", "", "base url, e.g. https://example.com/kci, overrides host and scheme")
+		ak        = fs.String("ak", "", "access key")
+		sk        = fs.String("sk", "", "secret key")
+		repoType  = fs.String("repo-type", "", "repo type of git remotes on hosts kci does not know, e.g. gitlab")
+		userAgent = fs.String("user-agent", "", "user agent")
+		scheme    = fs.String("scheme", "", "https or http")
+		caFile    = fs.String("ca-file", "", "PEM bundle of trusted CAs")
+		certFile  = fs.String("cert-file", "", "client certificate")
+		keyFile   = fs.String("key-file", "", "client certificate key")
+		proxy     = fs.String("proxy", "", "proxy url")
+		insecure  = fs.Bool("insecure", false, "skip TLS certificate verification")
+	)
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		return errors.New("context: missing subcommand")
+	}
+	reg, err := kciClient.LoadRegistry(*config)
+	if err != nil {
+		return err
+	}
+
+	name := ""
+	if len(pos) > 1 {
+		name = pos[1]
+	}
+	switch pos[0] {
+	case "list":
+		for _, n := range reg.Names() {
+			mark := " "
+			if n == reg.Current {
+				mark = "*"
+			}
+			c := reg.Contexts[n]
+			fmt.Printf("%s %s\t%s\t%s\n", mark, n, c.Host, c.AK)
+		}
+		return nil
+	case "use":
+		if name == "" {
+			return errors.New("context use: missing name")
+		}
+		if err := reg.Use(name); err != nil {
+			return err
+		}
+	case "set":
+		if name == "" {
+			return errors.New("context set: missing name")
+		}
+		c, ok := reg.Contexts[name]
+		if !ok {
+			c = new(kciClient.Context)
+		}
+		set := func(dst *string, v string) {
+			if v != "" {
+				*dst = v
+			}
+		}
+		set(&c.Host, *host)
+		set(&c.BaseURL, *baseURL)
+		set(&c.AK, *ak)
+		set(&c.SK, *sk)
+		set(&c.RepoType, *repoType)
+		set(&c.UserAgent, *userAgent)
+		set(&c.Scheme, *scheme)
+		set(&c.CAFile, *caFile)
+		set(&c.CertFile, *certFile)
+		set(&c.KeyFile, *keyFile)
+		set(&c.Proxy, *proxy)
+		if *insecure {
+			c.InsecureSkipVerify = true
+		}
+		reg.Set(name, c)
+	case "delete":
+		if name == "" {
+			return errors.New("context delete: missing name")
+		}
+		reg.Delete(name)
+	default:
+		return fmt.Errorf("context: unknown subcommand %q", pos[0])
+	}
+	return reg.Save()
+}
@@ -0,0 +1,66 @@
+// Command kci manages kci contexts and starts builds.
+//
+//	kci context list
+//	kci context use <name>
+//	kci context set <name> -host kci.example.com -ak ... -sk ...
+//	kci context delete <name>
+//	kci build start [-C dir] [-branch name]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: kci <command> [arguments]
+
+commands:
+  context list                  list contexts, * marks the current one
+  context use <name>            switch the current context
+  context set <name> [flags]    add or update a context
+  context delete <name>         remove a context
+  build start [flags]           start a build of the project of the current
+                                git checkout, on its current branch
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "context":
+		err = contextCmd(os.Args[2:])
+	case "build":
+		err = buildCmd(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "kci:", err)
+	os.Exit(1)
+}
+
+// parse parses flags that may follow positional arguments.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
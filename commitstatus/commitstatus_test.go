@@ -0,0 +1,237 @@
+package commitstatus
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func TestStateOf(t *testing.T) {
+	tests := []struct {
+		status string
+		state  State
+		ok     bool
+	}{
+		{kciClient.StatusPending, Pending, true},
+		{kciClient.StatusBlocked, Pending, true},
+		{kciClient.StatusRunning, Running, true},
+		{kciClient.StatusSuccess, Success, true},
+		{kciClient.StatusFailure, Failure, true},
+		{kciClient.StatusError, Error, true},
+		{kciClient.StatusKilled, Canceled, true},
+		{kciClient.StatusDeclined, Canceled, true},
+		{kciClient.StatusSkipped, "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		state, ok := StateOf(tt.status)
+		if state != tt.state || ok != tt.ok {
+			t.Errorf("%q: got %q %v, want %q %v", tt.status, state, ok, tt.state, tt.ok)
+		}
+	}
+}
+
+type posted struct {
+	uri    string
+	header http.Header
+	body   map[string]string
+}
+
+func forgeServer(t *testing.T, code int) (*httptest.Server, *posted) {
+	p := new(posted)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.uri = r.RequestURI
+		p.header = r.Header
+		json.NewDecoder(r.Body).Decode(&p.body)
+		w.WriteHeader(code)
+		w.Write([]byte(" nope \n"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, p
+}
+
+func TestForges(t *testing.T) {
+	status := func(state State) *Status {
+		return &Status{Owner: "group/sub", Repo: "app", SHA: "abc123", State: state,
+			Context: "kci/build", Description: "Build #1", TargetURL: "https://kci/1"}
+	}
+	tests := []struct {
+		name   string
+		forge  func(base string) Forge
+		state  State
+		code   int
+		uri    string
+		header [2]string
+		body   map[string]string
+		err    bool
+	}{
+		{"github", func(base string) Forge { return &GitHub{BaseURL: base, Token: "t"} }, Success, 201,
+			"/repos/group%2Fsub/app/statuses/abc123", [2]string{"Authorization", "token t"},
+			map[string]string{"state": "success", "context": "kci/build", "description": "Build #1", "target_url": "https://kci/1"}, false},
+		{"github running", func(base string) Forge { return &GitHub{BaseURL: base} }, Running, 201,
+			"/repos/group%2Fsub/app/statuses/abc123", [2]string{"Authorization", ""},
+			map[string]string{"state": "pending"}, false},
+		{"github canceled", func(base string) Forge { return &GitHub{BaseURL: base} }, Canceled, 201,
+			"/repos/group%2Fsub/app/statuses/abc123", [2]string{},
+			map[string]string{"state": "error"}, false},
+		{"gitlab", func(base string) Forge { return &GitLab{BaseURL: base + "/", Token: "t"} }, Running, 201,
+			"/projects/group%2Fsub%2Fapp/statuses/abc123", [2]string{"Private-Token", "t"},
+			map[string]string{"state": "running", "name": "kci/build", "description": "Build #1", "target_url": "https://kci/1"}, false},
+		{"gitlab failure", func(base string) Forge { return &GitLab{BaseURL: base} }, Failure, 201,
+			"/projects/group%2Fsub%2Fapp/statuses/abc123", [2]string{},
+			map[string]string{"state": "failed"}, false},
+		{"gitlab canceled", func(base string) Forge { return &GitLab{BaseURL: base} }, Canceled, 201,
+			"/projects/group%2Fsub%2Fapp/statuses/abc123", [2]string{},
+			map[string]string{"state": "canceled"}, false},
+		{"refused", func(base string) Forge { return &GitLab{BaseURL: base} }, Pending, 403,
+			"/projects/group%2Fsub%2Fapp/statuses/abc123", [2]string{},
+			map[string]string{"state": "pending"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, p := forgeServer(t, tt.code)
+			err := tt.forge(ts.URL).SetStatus(status(tt.state))
+			if tt.err {
+				want := "commitstatus: group/sub/app@abc123: 403 Forbidden: nope"
+				if err == nil || err.Error() != want {
+					t.Errorf("got %v, want %s", err, want)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if p.uri != tt.uri {
+				t.Errorf("uri %s, want %s", p.uri, tt.uri)
+			}
+			if tt.header[0] != "" && p.header.Get(tt.header[0]) != tt.header[1] {
+				t.Errorf("%s: %q, want %q", tt.header[0], p.header.Get(tt.header[0]), tt.header[1])
+			}
+			for k, v := range tt.body {
+				if p.body[k] != v {
+					t.Errorf("%s: %q, want %q", k, p.body[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"构建已经完成了吗", 5, "构建已经…"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+var testProj = &kciClient.Project{ID: 1, ProjName: "app", RepoType: "gitlab", RepoOwner: "group", RepoName: "app"}
+
+func TestReport(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name  string
+		proj  *kciClient.Project
+		build *kciClient.Build
+		want  *Status // nil for nothing posted
+	}{
+		{"running", testProj, &kciClient.Build{Number: 3, Status: kciClient.StatusRunning, Commit: "abc", LinkUrl: "l"},
+			&Status{Owner: "group", Repo: "app", SHA: "abc", State: Running, Context: "kci/build", Description: "Build #3 is running", TargetURL: "l"}},
+		{"finished, project looked up", nil, &kciClient.Build{Number: 3, ProjectId: 1, Status: kciClient.StatusFailure, Commit: "abc", Started: start, Finished: start.Add(90 * time.Second)},
+			&Status{Owner: "group", Repo: "app", SHA: "abc", State: Failure, Context: "kci/build", Description: "Build #3 failure in 1m30s"}},
+		{"skipped", testProj, &kciClient.Build{Number: 3, Status: kciClient.StatusSkipped, Commit: "abc"}, nil},
+		{"no commit", testProj, &kciClient.Build{Number: 3, Status: kciClient.StatusSuccess}, nil},
+		{"no forge", &kciClient.Project{RepoType: "bitbucket"}, &kciClient.Build{Number: 3, Status: kciClient.StatusSuccess, Commit: "abc"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := kciClient.NewMockClient()
+			m.ProjFunc = func(projId int64) (*kciClient.Project, error) { return testProj, nil }
+			fake := new(Fake)
+			r := NewReporter(m)
+			r.Forges["gitlab"] = fake
+			if err := r.Report(tt.proj, tt.build); err != nil {
+				t.Fatal(err)
+			}
+			got := fake.Statuses()
+			if tt.want == nil {
+				if len(got) != 0 {
+					t.Errorf("posted %+v", got[0])
+				}
+				return
+			}
+			if len(got) != 1 || *got[0] != *tt.want {
+				t.Fatalf("posted %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportError(t *testing.T) {
+	r := NewReporter(kciClient.NewMockClient())
+	r.Forges["gitlab"] = &Fake{Err: errors.New("down")}
+	err := r.Report(testProj, &kciClient.Build{Number: 3, Status: kciClient.StatusSuccess, Commit: "abc"})
+	if err == nil || err.Error() != "commitstatus: app #3: down" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestListen(t *testing.T) {
+	m := kciClient.NewMockClient()
+	fake := new(Fake)
+	r := NewReporter(m)
+	r.Forges["gitlab"] = fake
+
+	push := func(status string) {
+		msg, _ := json.Marshal(&kciClient.FeedEvent{Project: testProj, Build: &kciClient.Build{Number: 5, Status: status, Commit: "abc"}})
+		m.PushFeed(1, msg)
+	}
+	push(kciClient.StatusPending)
+	push(kciClient.StatusRunning)
+	push(kciClient.StatusRunning) // repeated by the feed
+	push(kciClient.StatusSkipped)
+	push(kciClient.StatusSuccess)
+	m.CloseFeed(1)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Listen(1, stop)
+		close(done)
+	}()
+	// the second FeedWs is the reconnect after the closed feed was drained
+	deadline := time.After(5 * time.Second)
+	for len(m.CallsTo("FeedWs")) < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("no reconnect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(stop)
+	<-done
+
+	var states []State
+	for _, s := range fake.Statuses() {
+		states = append(states, s.State)
+	}
+	want := []State{Pending, Running, Success}
+	if len(states) != len(want) || states[0] != want[0] || states[1] != want[1] || states[2] != want[2] {
+		t.Errorf("posted %v, want %v", states, want)
+	}
+	if s := fake.Latest("group", "app", "abc", "kci/build"); s == nil || s.State != Success {
+		t.Errorf("latest %+v", s)
+	}
+	m.AssertNotCalled(t, "Proj")
+}
@@ -0,0 +1,204 @@
+package commitstatus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// State is the state of a commit status.
+type State string
+
+// commit status states, as named by GitHub and Gitea. Forges without
+// Running and Canceled post them as Pending and Error.
+const (
+	Pending  State = "pending"
+	Running  State = "running"
+	Success  State = "success"
+	Failure  State = "failure"
+	Error    State = "error"
+	Canceled State = "canceled"
+)
+
+// Status is a commit status to post.
+type Status struct {
+	Owner       string
+	Repo        string
+	SHA         string
+	State       State
+	Context     string // e.g. kci/build, identifies the status on the commit
+	Description string
+	TargetURL   string
+}
+
+// Forge posts commit statuses to a source repository host.
+type Forge interface {
+	SetStatus(s *Status) error
+}
+
+// ---------------------------------------------------------------------------------------
+
+// GitHub posts statuses with the GitHub statuses api, which Gitea also
+// implements under /api/v1.
+type GitHub struct {
+	BaseURL string       // e.g. https://api.github.com or https://gitea.example.com/api/v1
+	Token   string       // sent as "Authorization: token ..."
+	Client  *http.Client // defaults to http.DefaultClient
+}
+
+// NewGitHub returns a forge for api.github.com.
+func NewGitHub(token string) *GitHub {
+	return &GitHub{BaseURL: "https://api.github.com", Token: token}
+}
+
+func (g *GitHub) SetStatus(s *Status) error {
+	state := s.State
+	switch state {
+	case Running:
+		state = Pending
+	case Canceled:
+		state = Error
+	}
+	uri := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", strings.TrimRight(g.BaseURL, "/"),
+		url.PathEscape(s.Owner), url.PathEscape(s.Repo), url.PathEscape(s.SHA))
+	header := http.Header{"Accept": {"application/vnd.github+json"}}
+	if g.Token != "" {
+		header.Set("Authorization", "token "+g.Token)
+	}
+	return post(g.Client, uri, header, s, map[string]string{
+		"state":       string(state),
+		"target_url":  s.TargetURL,
+		"description": truncate(s.Description, 140),
+		"context":     s.Context,
+	})
+}
+
+// ---------------------------------------------------------------------------------------
+
+// GitLab posts statuses with the GitLab commit statuses api. The project is
+// addressed by its path, Owner/Repo, so Owner may hold nested groups.
+type GitLab struct {
+	BaseURL string       // e.g. https://gitlab.com/api/v4
+	Token   string       // sent as "PRIVATE-TOKEN: ..."
+	Client  *http.Client // defaults to http.DefaultClient
+}
+
+// NewGitLab returns a forge for gitlab.com.
+func NewGitLab(token string) *GitLab {
+	return &GitLab{BaseURL: "https://gitlab.com/api/v4", Token: token}
+}
+
+// gitlab state names
+var gitlabStates = map[State]string{
+	Pending:  "pending",
+	Running:  "running",
+	Success:  "success",
+	Failure:  "failed",
+	Error:    "failed",
+	Canceled: "canceled",
+}
+
+func (g *GitLab) SetStatus(s *Status) error {
+	state, ok := gitlabStates[s.State]
+	if !ok {
+		return fmt.Errorf("commitstatus: gitlab has no state %q", s.State)
+	}
+	uri := fmt.Sprintf("%s/projects/%s/statuses/%s", strings.TrimRight(g.BaseURL, "/"),
+		url.PathEscape(s.Owner+"/"+s.Repo), url.PathEscape(s.SHA))
+	header := http.Header{}
+	if g.Token != "" {
+		header.Set("PRIVATE-TOKEN", g.Token)
+	}
+	return post(g.Client, uri, header, s, map[string]string{
+		"state":       state,
+		"target_url":  s.TargetURL,
+		"description": truncate(s.Description, 255),
+		"name":        s.Context,
+	})
+}
+
+// post sends v as JSON to uri and fails on statuses other than 2xx.
+func post(client *http.Client, uri string, header http.Header, s *Status, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		out, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("commitstatus: %s/%s@%s: %s: %s", s.Owner, s.Repo, s.SHA, resp.Status, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// truncate shortens s to n runes, the length a forge accepts for
+// descriptions.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// ---------------------------------------------------------------------------------------
+
+// Fake is an in-memory forge for tests.
+type Fake struct {
+	Err error // returned by SetStatus when set
+
+	mu       sync.Mutex
+	statuses []*Status
+}
+
+func (f *Fake) SetStatus(s *Status) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	cp := *s
+	f.statuses = append(f.statuses, &cp)
+	return nil
+}
+
+// Statuses returns the statuses posted so far, in order.
+func (f *Fake) Statuses() []*Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Status(nil), f.statuses...)
+}
+
+// Latest returns the last status posted for a commit and context, or nil.
+func (f *Fake) Latest(owner, repo, sha, context string) *Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.statuses) - 1; i >= 0; i-- {
+		s := f.statuses[i]
+		if s.Owner == owner && s.Repo == repo && s.SHA == sha && s.Context == context {
+			return s
+		}
+	}
+	return nil
+}
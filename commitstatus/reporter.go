@@ -0,0 +1,152 @@
+// Package commitstatus posts kci build results as commit statuses to the
+// repository a project builds. A Reporter follows FeedWs and posts through
+// the Forge registered for the project's RepoType:
+//
+//	r := commitstatus.NewReporter(client)
+//	r.Forges["github"] = commitstatus.NewGitHub(token)
+//	r.Forges["gitea"] = &commitstatus.GitHub{BaseURL: "https://git.example.com/api/v1", Token: token}
+//	r.Forges["gitlab"] = commitstatus.NewGitLab(token)
+//	r.Listen(userid, stop)
+package commitstatus
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// StateOf maps a build status to a commit status state. ok is false for
+// statuses not worth reporting, like skipped.
+func StateOf(status string) (state State, ok bool) {
+	switch status {
+	case kciClient.StatusPending, kciClient.StatusBlocked:
+		return Pending, true
+	case kciClient.StatusRunning:
+		return Running, true
+	case kciClient.StatusSuccess:
+		return Success, true
+	case kciClient.StatusFailure:
+		return Failure, true
+	case kciClient.StatusError:
+		return Error, true
+	case kciClient.StatusKilled, kciClient.StatusDeclined:
+		return Canceled, true
+	}
+	return "", false
+}
+
+// Reporter posts the statuses of builds.
+type Reporter struct {
+	Client  kciClient.Client // looks up projects missing from events
+	Forges  map[string]Forge // by Project.RepoType
+	Context string           // defaults to kci/build
+
+	// OnError, if set, is told about statuses Listen failed to post and
+	// about feed connects that failed.
+	OnError func(err error)
+
+	mu       sync.Mutex
+	projects map[int64]*kciClient.Project
+}
+
+// NewReporter returns a reporter without forges.
+func NewReporter(c kciClient.Client) *Reporter {
+	return &Reporter{Client: c, Forges: map[string]Forge{}}
+}
+
+// Status returns the commit status of a build of proj, ok false if the
+// build status is not reported.
+func (r *Reporter) Status(proj *kciClient.Project, b *kciClient.Build) (s *Status, ok bool) {
+	state, ok := StateOf(b.Status)
+	if !ok || b.Commit == "" {
+		return nil, false
+	}
+	context := r.Context
+	if context == "" {
+		context = "kci/build"
+	}
+	return &Status{
+		Owner:       proj.RepoOwner,
+		Repo:        proj.RepoName,
+		SHA:         b.Commit,
+		State:       state,
+		Context:     context,
+		Description: description(b),
+		TargetURL:   b.LinkUrl,
+	}, true
+}
+
+func description(b *kciClient.Build) string {
+	switch {
+	case b.Status == kciClient.StatusPending:
+		return fmt.Sprintf("Build #%d is queued", b.Number)
+	case b.Status == kciClient.StatusRunning:
+		return fmt.Sprintf("Build #%d is running", b.Number)
+	case kciClient.IsDone(b.Status) && b.Finished.After(b.Started) && !b.Started.IsZero():
+		return fmt.Sprintf("Build #%d %s in %s", b.Number, b.Status, b.Finished.Sub(b.Started).Round(time.Second))
+	}
+	return fmt.Sprintf("Build #%d %s", b.Number, b.Status)
+}
+
+// Report posts the status of a build. proj may be nil, in which case it is
+// looked up with Client. Builds of projects without a forge for their
+// RepoType are ignored.
+func (r *Reporter) Report(proj *kciClient.Project, b *kciClient.Build) error {
+	if proj == nil || proj.RepoType == "" {
+		p, err := r.project(b.ProjectId)
+		if err != nil {
+			return err
+		}
+		proj = p
+	}
+	forge, ok := r.Forges[proj.RepoType]
+	if !ok {
+		return nil
+	}
+	s, ok := r.Status(proj, b)
+	if !ok {
+		return nil
+	}
+	if err := forge.SetStatus(s); err != nil {
+		return fmt.Errorf("commitstatus: %s #%d: %v", proj.ProjName, b.Number, err)
+	}
+	return nil
+}
+
+// project returns a project, asking the server once per project.
+func (r *Reporter) project(id int64) (*kciClient.Project, error) {
+	r.mu.Lock()
+	p, ok := r.projects[id]
+	r.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+	p, err := r.Client.Proj(id)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	if r.projects == nil {
+		r.projects = map[int64]*kciClient.Project{}
+	}
+	r.projects[id] = p
+	r.mu.Unlock()
+	return p, nil
+}
+
+// Listen reports the builds pushed by FeedWs until stop is closed,
+// reconnecting with backoff. A status is posted once per build even if the
+// feed repeats it; one that failed to post is retried on the next repeat.
+func (r *Reporter) Listen(userid uint64, stop <-chan struct{}) {
+	kciClient.FollowFeed(r.Client, userid, stop, func(ev *kciClient.FeedEvent) error {
+		return r.Report(ev.Project, ev.Build)
+	}, r.error)
+}
+
+func (r *Reporter) error(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+}
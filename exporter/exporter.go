@@ -0,0 +1,379 @@
+// Package exporter exports kci projects and builds as Prometheus metrics. It
+// polls ProjList/BuildList, optionally follows FeedWs for live updates, and
+// serves the text exposition format without any prometheus dependency.
+// ServeHTTP is the supported way to expose the metrics; a process that
+// already runs a prometheus registry serves it on a path of its own next to
+// the registry's handler.
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// DefaultBuckets are the duration histogram bounds in seconds.
+var DefaultBuckets = []float64{30, 60, 120, 300, 600, 900, 1800, 3600}
+
+var (
+	descProjects = &Desc{
+		Name: "kci_projects",
+		Help: "Number of kci projects.",
+		Type: Gauge,
+	}
+	descRunning = &Desc{
+		Name:   "kci_builds_running",
+		Help:   "Number of running builds.",
+		Type:   Gauge,
+		Labels: []string{"project"},
+	}
+	descPending = &Desc{
+		Name:   "kci_builds_pending",
+		Help:   "Number of builds waiting to run.",
+		Type:   Gauge,
+		Labels: []string{"project"},
+	}
+	descBuilds = &Desc{
+		Name:   "kci_builds_total",
+		Help:   "Finished builds seen since the exporter started, by status and event.",
+		Type:   Counter,
+		Labels: []string{"project", "status", "event"},
+	}
+	descDuration = &Desc{
+		Name:   "kci_build_duration_seconds",
+		Help:   "Run time of finished builds.",
+		Type:   Histogram,
+		Labels: []string{"project"},
+	}
+	descPollErrors = &Desc{
+		Name: "kci_exporter_poll_errors_total",
+		Help: "Number of failed api calls while polling.",
+		Type: Counter,
+	}
+	descLastPoll = &Desc{
+		Name: "kci_exporter_last_poll_timestamp_seconds",
+		Help: "Unix time of the last successful poll.",
+		Type: Gauge,
+	}
+)
+
+type buildKey struct {
+	proj int64
+	num  int
+}
+
+type countKey struct {
+	proj          int64
+	status, event string
+}
+
+// Exporter keeps the state behind the exported metrics. It is safe for
+// concurrent use.
+type Exporter struct {
+	Interval time.Duration // poll interval of Run, defaults to one minute
+	Buckets  []float64     // duration histogram bounds, defaults to DefaultBuckets
+
+	// OnError, if set, is told about the failed polls of Run and the failed
+	// connects of Listen, which are otherwise only retried.
+	OnError func(err error)
+
+	client kciClient.Client
+
+	mu         sync.Mutex
+	projects   map[int64]string              // id to name
+	active     map[buildKey]*kciClient.Build // builds not finished yet
+	counted    map[buildKey]bool             // finished builds already counted
+	seed       map[int64]bool                // projects whose history is not counted yet
+	polled     bool                          // projects were listed at least once
+	totals     map[countKey]float64
+	durations  map[int64]*histogram // per project
+	pollErrors float64
+	lastPoll   time.Time
+}
+
+// New returns an exporter reading from c.
+func New(c kciClient.Client) *Exporter {
+	return &Exporter{
+		Interval:  time.Minute,
+		Buckets:   DefaultBuckets,
+		client:    c,
+		projects:  map[int64]string{},
+		active:    map[buildKey]*kciClient.Build{},
+		counted:   map[buildKey]bool{},
+		seed:      map[int64]bool{},
+		totals:    map[countKey]float64{},
+		durations: map[int64]*histogram{},
+	}
+}
+
+// Poll refreshes projects and builds from the api. A project whose builds
+// fail to load keeps its previous state; every failed call is counted in
+// kci_exporter_poll_errors_total and the first error is returned.
+//
+// Builds that had finished before the first poll are not added to
+// kci_builds_total, which counts builds finished while the exporter runs.
+func (e *Exporter) Poll() error {
+	projs, err := e.client.ProjList()
+	if err != nil {
+		e.mu.Lock()
+		e.pollErrors++
+		e.mu.Unlock()
+		return err
+	}
+	var (
+		builds   = map[int64][]*kciClient.Build{}
+		failed   float64
+		firstErr error
+	)
+	for _, p := range projs {
+		bs, err := e.client.BuildList(p.ID)
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("project %d: %v", p.ID, err)
+			}
+			continue
+		}
+		builds[p.ID] = bs
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.polled {
+		e.polled = true
+		for _, p := range projs {
+			e.seed[p.ID] = true
+		}
+	}
+	e.projects = map[int64]string{}
+	for _, p := range projs {
+		e.projects[p.ID] = p.ProjName
+	}
+	for key := range e.active {
+		_, loaded := builds[key.proj]
+		if _, ok := e.projects[key.proj]; loaded || !ok {
+			delete(e.active, key)
+		}
+	}
+	for id, bs := range builds {
+		seed := e.seed[id]
+		delete(e.seed, id)
+		for _, b := range bs {
+			if seed && kciClient.IsDone(b.Status) {
+				e.counted[buildKey{id, b.Number}] = true
+				continue
+			}
+			e.observe(id, b)
+		}
+	}
+	e.prune(builds)
+
+	e.pollErrors += failed
+	if firstErr == nil {
+		e.lastPoll = time.Now()
+	}
+	return firstErr
+}
+
+// prune forgets the builds and projects that the api no longer lists, so
+// counted stays as large as the build lists. Projects whose builds failed to
+// load keep theirs.
+func (e *Exporter) prune(builds map[int64][]*kciClient.Build) {
+	listed := map[buildKey]bool{}
+	for id, bs := range builds {
+		for _, b := range bs {
+			listed[buildKey{id, b.Number}] = true
+		}
+	}
+	for key := range e.counted {
+		_, loaded := builds[key.proj]
+		if _, ok := e.projects[key.proj]; (loaded && !listed[key]) || !ok {
+			delete(e.counted, key)
+		}
+	}
+	for id := range e.seed {
+		if _, ok := e.projects[id]; !ok {
+			delete(e.seed, id)
+		}
+	}
+}
+
+// Observe records the state of a build, e.g. one received from FeedWs.
+func (e *Exporter) Observe(proj *kciClient.Project, b *kciClient.Build) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := b.ProjectId
+	if proj != nil {
+		id = proj.ID
+		e.projects[id] = proj.ProjName
+	}
+	e.observe(id, b)
+}
+
+func (e *Exporter) observe(proj int64, b *kciClient.Build) {
+	key := buildKey{proj, b.Number}
+	if !kciClient.IsDone(b.Status) {
+		e.active[key] = b
+		return
+	}
+	delete(e.active, key)
+	if e.counted[key] {
+		return
+	}
+	e.counted[key] = true
+	e.totals[countKey{proj, b.Status, b.Event}]++
+	if !b.Started.IsZero() && b.Finished.After(b.Started) {
+		h := e.durations[proj]
+		if h == nil {
+			h = newHistogram(e.Buckets)
+			e.durations[proj] = h
+		}
+		h.observe(b.Finished.Sub(b.Started).Seconds())
+	}
+}
+
+// Run polls every Interval until stop is closed. Poll errors are counted in
+// kci_exporter_poll_errors_total.
+func (e *Exporter) Run(stop <-chan struct{}) {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	e.poll()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.poll()
+		}
+	}
+}
+
+func (e *Exporter) poll() {
+	if err := e.Poll(); err != nil {
+		e.error(err)
+	}
+}
+
+func (e *Exporter) error(err error) {
+	if e.OnError != nil {
+		e.OnError(err)
+	}
+}
+
+// Listen follows the build feed of a user until stop is closed, reconnecting
+// when the websocket drops.
+func (e *Exporter) Listen(userid uint64, stop <-chan struct{}) {
+	kciClient.FollowFeed(e.client, userid, stop, func(ev *kciClient.FeedEvent) error {
+		e.Observe(ev.Project, ev.Build)
+		return nil
+	}, e.error)
+}
+
+// Descs returns the descriptions of all exported families.
+func (e *Exporter) Descs() []*Desc {
+	return []*Desc{descProjects, descRunning, descPending, descBuilds, descDuration, descPollErrors, descLastPoll}
+}
+
+func (e *Exporter) name(proj int64) string {
+	if name, ok := e.projects[proj]; ok && name != "" {
+		return name
+	}
+	return fmt.Sprint(proj)
+}
+
+// Metrics returns the current value of every metric, grouped by family.
+func (e *Exporter) Metrics() []*Metric {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := []*Metric{{Desc: descProjects, Value: float64(len(e.projects))}}
+
+	running, pending := map[int64]float64{}, map[int64]float64{}
+	for id := range e.projects {
+		running[id], pending[id] = 0, 0
+	}
+	for key, b := range e.active {
+		switch b.Status {
+		case kciClient.StatusRunning:
+			running[key.proj]++
+		case kciClient.StatusPending:
+			pending[key.proj]++
+		}
+	}
+	for _, id := range sortedIds(running) {
+		out = append(out, &Metric{Desc: descRunning, LabelValues: []string{e.name(id)}, Value: running[id]})
+	}
+	for _, id := range sortedIds(pending) {
+		out = append(out, &Metric{Desc: descPending, LabelValues: []string{e.name(id)}, Value: pending[id]})
+	}
+
+	var keys []countKey
+	for k := range e.totals {
+		keys = append(keys, k)
+	}
+	sort.Sort(byCountKey(keys))
+	for _, k := range keys {
+		out = append(out, &Metric{Desc: descBuilds, LabelValues: []string{e.name(k.proj), k.status, k.event}, Value: e.totals[k]})
+	}
+
+	var ids []int64
+	for id := range e.durations {
+		ids = append(ids, id)
+	}
+	sort.Sort(int64s(ids))
+	for _, id := range ids {
+		out = append(out, e.durations[id].metric(descDuration, e.name(id)))
+	}
+
+	out = append(out, &Metric{Desc: descPollErrors, Value: e.pollErrors})
+	var last float64
+	if !e.lastPoll.IsZero() {
+		last = float64(e.lastPoll.Unix())
+	}
+	out = append(out, &Metric{Desc: descLastPoll, Value: last})
+	return out
+}
+
+func sortedIds(m map[int64]float64) []int64 {
+	var ids []int64
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Sort(int64s(ids))
+	return ids
+}
+
+type int64s []int64
+
+func (p int64s) Len() int           { return len(p) }
+func (p int64s) Less(i, j int) bool { return p[i] < p[j] }
+func (p int64s) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type byCountKey []countKey
+
+func (p byCountKey) Len() int      { return len(p) }
+func (p byCountKey) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byCountKey) Less(i, j int) bool {
+	a, b := p[i], p[j]
+	if a.proj != b.proj {
+		return a.proj < b.proj
+	}
+	if a.status != b.status {
+		return a.status < b.status
+	}
+	return a.event < b.event
+}
+
+// ServeHTTP serves the metrics in the text exposition format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteText(w, e.Metrics())
+}
@@ -0,0 +1,173 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func finished(num int, status string) *kciClient.Build {
+	return &kciClient.Build{Number: num, Status: status, Event: "push", Started: t0, Finished: t0.Add(90 * time.Second)}
+}
+
+// sample returns the value of the metric of family name with labels, or -1.
+func sample(e *Exporter, name string, labels ...string) float64 {
+	for _, m := range e.Metrics() {
+		if m.Desc.Name == name && fmt.Sprint(m.LabelValues) == fmt.Sprint(labels) {
+			if m.Desc.Type == Histogram {
+				return float64(m.Count)
+			}
+			return m.Value
+		}
+	}
+	return -1
+}
+
+func TestPoll(t *testing.T) {
+	var (
+		builds  = map[int64][]*kciClient.Build{}
+		failing = map[int64]bool{}
+	)
+	m := kciClient.NewMockClient()
+	m.ProjListFunc = func() ([]*kciClient.Project, error) {
+		return []*kciClient.Project{{ID: 1, ProjName: "a"}, {ID: 2, ProjName: "b"}}, nil
+	}
+	m.BuildListFunc = func(projId int64) ([]*kciClient.Build, error) {
+		if failing[projId] {
+			return nil, errors.New("boom")
+		}
+		return builds[projId], nil
+	}
+	e := New(m)
+
+	type state struct {
+		a1, b1, running, errs float64
+	}
+	steps := []struct {
+		name    string
+		a, b    []*kciClient.Build
+		failing int64
+		want    state
+	}{
+		{"history is not counted",
+			[]*kciClient.Build{finished(1, kciClient.StatusSuccess), {Number: 2, Status: kciClient.StatusRunning}},
+			[]*kciClient.Build{finished(1, kciClient.StatusFailure)}, 0,
+			state{a1: -1, b1: -1, running: 1}},
+		{"new builds are counted once",
+			[]*kciClient.Build{finished(1, kciClient.StatusSuccess), finished(2, kciClient.StatusSuccess)},
+			[]*kciClient.Build{finished(1, kciClient.StatusFailure), finished(2, kciClient.StatusFailure)}, 0,
+			state{a1: 1, b1: 1, running: 0}},
+		{"a failing project does not stop the poll",
+			[]*kciClient.Build{finished(1, kciClient.StatusSuccess), finished(2, kciClient.StatusSuccess), finished(3, kciClient.StatusSuccess)},
+			nil, 2,
+			state{a1: 2, b1: 1, running: 0, errs: 1}},
+		{"recovered project",
+			[]*kciClient.Build{finished(3, kciClient.StatusSuccess)},
+			[]*kciClient.Build{finished(2, kciClient.StatusFailure), finished(3, kciClient.StatusFailure)}, 0,
+			state{a1: 2, b1: 2, running: 0, errs: 1}},
+	}
+	for _, s := range steps {
+		builds[1], builds[2] = s.a, s.b
+		failing = map[int64]bool{s.failing: true}
+		err := e.Poll()
+		if (err != nil) != (s.failing != 0) {
+			t.Errorf("%s: error %v", s.name, err)
+		}
+		got := state{
+			a1:      sample(e, "kci_builds_total", "a", kciClient.StatusSuccess, "push"),
+			b1:      sample(e, "kci_builds_total", "b", kciClient.StatusFailure, "push"),
+			running: sample(e, "kci_builds_running", "a"),
+			errs:    sample(e, "kci_exporter_poll_errors_total"),
+		}
+		if got != s.want {
+			t.Errorf("%s: got %+v, want %+v", s.name, got, s.want)
+		}
+	}
+
+	// only the builds still listed are remembered
+	if len(e.counted) != 3 {
+		t.Errorf("counted %d builds, want 3", len(e.counted))
+	}
+	if n := sample(e, "kci_build_duration_seconds", "a"); n != 2 {
+		t.Errorf("duration count %v, want 2", n)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	m := kciClient.NewMockClient()
+	e := New(m)
+	p := &kciClient.Project{ID: 7, ProjName: "feed"}
+	e.Observe(p, &kciClient.Build{Number: 1, Status: kciClient.StatusPending})
+	if v := sample(e, "kci_builds_pending", "feed"); v != 1 {
+		t.Errorf("pending %v, want 1", v)
+	}
+	e.Observe(p, finished(1, kciClient.StatusKilled))
+	e.Observe(p, finished(1, kciClient.StatusKilled))
+	if v := sample(e, "kci_builds_total", "feed", kciClient.StatusKilled, "push"); v != 1 {
+		t.Errorf("total %v, want 1", v)
+	}
+	if v := sample(e, "kci_builds_pending", "feed"); v != 0 {
+		t.Errorf("pending %v, want 0", v)
+	}
+}
+
+func TestListen(t *testing.T) {
+	m := kciClient.NewMockClient()
+	e := New(m)
+	errs := make(chan error, 1)
+	e.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	m.FeedWsFunc = func(userid uint64) (<-chan []byte, error) {
+		return nil, errors.New("401 unauthorized")
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		e.Listen(1, stop)
+		close(done)
+	}()
+	select {
+	case err := <-errs:
+		if err.Error() != "401 unauthorized" {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connect error not reported")
+	}
+	close(stop)
+	<-done
+}
+
+func TestRunReportsPollErrors(t *testing.T) {
+	m := kciClient.NewMockClient()
+	m.ProjListFunc = func() ([]*kciClient.Project, error) { return nil, errors.New("down") }
+	e := New(m)
+	errs := make(chan error, 1)
+	e.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	stop := make(chan struct{})
+	go e.Run(stop)
+	defer close(stop)
+	select {
+	case err := <-errs:
+		if err.Error() != "down" {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("poll error not reported")
+	}
+}
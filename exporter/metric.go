@@ -0,0 +1,137 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metric types of the text exposition format
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// Desc describes a metric family. Together with Metric it carries what
+// other metric systems need to adapt the exporter, see Exporter.Descs and
+// Exporter.Metrics.
+type Desc struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+// Metric is one sample of a family. Buckets, Sum and Count are only used by
+// histograms.
+type Metric struct {
+	Desc        *Desc
+	LabelValues []string
+	Value       float64
+	Buckets     map[float64]uint64 // upper bound to cumulative count
+	Sum         float64
+	Count       uint64
+}
+
+// histogram accumulates observations into fixed buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.sum += v
+	h.count++
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+func (h *histogram) metric(d *Desc, labels ...string) *Metric {
+	m := &Metric{Desc: d, LabelValues: labels, Buckets: map[float64]uint64{}, Sum: h.sum, Count: h.count}
+	var cum uint64
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		m.Buckets[b] = cum
+	}
+	return m
+}
+
+// WriteText writes metrics in the Prometheus text exposition format. Metrics
+// of a family must be adjacent.
+func WriteText(w io.Writer, metrics []*Metric) error {
+	bw := bufio.NewWriter(w)
+	var last *Desc
+	for _, m := range metrics {
+		d := m.Desc
+		if d != last {
+			fmt.Fprintf(bw, "# HELP %s %s\n", d.Name, escapeHelp(d.Help))
+			fmt.Fprintf(bw, "# TYPE %s %s\n", d.Name, d.Type)
+			last = d
+		}
+		if d.Type != Histogram {
+			fmt.Fprintf(bw, "%s%s %s\n", d.Name, labels(d.Labels, m.LabelValues, "", 0), value(m.Value))
+			continue
+		}
+		var bounds []float64
+		for b := range m.Buckets {
+			bounds = append(bounds, b)
+		}
+		sort.Float64s(bounds)
+		for _, b := range bounds {
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", d.Name, labels(d.Labels, m.LabelValues, "le", b), m.Buckets[b])
+		}
+		fmt.Fprintf(bw, "%s_bucket%s %d\n", d.Name, labels(d.Labels, m.LabelValues, "le", math.Inf(1)), m.Count)
+		fmt.Fprintf(bw, "%s_sum%s %s\n", d.Name, labels(d.Labels, m.LabelValues, "", 0), value(m.Sum))
+		fmt.Fprintf(bw, "%s_count%s %d\n", d.Name, labels(d.Labels, m.LabelValues, "", 0), m.Count)
+	}
+	return bw.Flush()
+}
+
+func labels(names, values []string, extra string, extraValue float64) string {
+	var pairs []string
+	for i, n := range names {
+		pairs = append(pairs, n+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extra != "" {
+		pairs = append(pairs, extra+`="`+value(extraValue)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func value(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,47 @@
+package exporter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	h := newHistogram([]float64{1, 10})
+	for _, v := range []float64{0.5, 5, 50} {
+		h.observe(v)
+	}
+	tests := []struct {
+		name    string
+		metrics []*Metric
+		want    string
+	}{
+		{"gauge", []*Metric{{Desc: descProjects, Value: 3}},
+			"# HELP kci_projects Number of kci projects.\n# TYPE kci_projects gauge\nkci_projects 3\n"},
+		{"labels share header", []*Metric{
+			{Desc: descRunning, LabelValues: []string{"a"}, Value: 1},
+			{Desc: descRunning, LabelValues: []string{`q"\` + "\n"}, Value: 0.5},
+		}, "# HELP kci_builds_running Number of running builds.\n# TYPE kci_builds_running gauge\n" +
+			"kci_builds_running{project=\"a\"} 1\n" +
+			"kci_builds_running{project=\"q\\\"\\\\\\n\"} 0.5\n"},
+		{"escaped help", []*Metric{{Desc: &Desc{Name: "x", Help: "a\\b\nc", Type: Counter}, Value: 1e21}},
+			"# HELP x a\\\\b\\nc\n# TYPE x counter\nx 1e+21\n"},
+		{"histogram", []*Metric{h.metric(descDuration, "p")},
+			"# HELP kci_build_duration_seconds Run time of finished builds.\n# TYPE kci_build_duration_seconds histogram\n" +
+				"kci_build_duration_seconds_bucket{project=\"p\",le=\"1\"} 1\n" +
+				"kci_build_duration_seconds_bucket{project=\"p\",le=\"10\"} 2\n" +
+				"kci_build_duration_seconds_bucket{project=\"p\",le=\"+Inf\"} 3\n" +
+				"kci_build_duration_seconds_sum{project=\"p\"} 55.5\n" +
+				"kci_build_duration_seconds_count{project=\"p\"} 3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteText(&buf, tt.metrics); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Package gitremote finds the kci project of a git checkout from its
+// remotes, and the branch checked out, so that a build can be started from
+// inside the checkout:
+//
+//	r, err := gitremote.Resolve(client, ".", "")
+//	build, err := client.BuildPost(r.Project.ID, r.Branch)
+package gitremote
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRepo is returned when no .git is found in a directory or its
+// parents.
+var ErrNotRepo = errors.New("gitremote: not a git repository")
+
+// ErrDetached is returned by Branch when HEAD is not on a branch.
+var ErrDetached = errors.New("gitremote: HEAD is detached")
+
+// Remote is a remote of .git/config.
+type Remote struct {
+	Name string
+	URL  string
+}
+
+// Repo is a repository parsed from a remote url.
+type Repo struct {
+	Type  string // kci repo type, e.g. github, or "" for unknown hosts
+	Host  string
+	Owner string
+	Name  string
+}
+
+// FullName returns owner/name.
+func (r *Repo) FullName() string {
+	return r.Owner + "/" + r.Name
+}
+
+// repo types by host
+var repoTypes = map[string]string{
+	"github.com":    "github",
+	"gitlab.com":    "gitlab",
+	"bitbucket.org": "bitbucket",
+}
+
+// ParseURL parses the GitHub style remote urls:
+//
+//	git@github.com:owner/name.git
+//	ssh://git@github.com:22/owner/name.git
+//	https://github.com/owner/name.git
+//	git://github.com/owner/name
+func ParseURL(raw string) (*Repo, error) {
+	var host, path string
+	if i := strings.Index(raw, "://"); i >= 0 {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		host, path = u.Hostname(), u.Path
+	} else if i := strings.Index(raw, ":"); i > 0 && !strings.Contains(raw[:i], "/") {
+		// scp-like syntax, [user@]host:path
+		host, path = raw[:i], raw[i+1:]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+	} else {
+		return nil, fmt.Errorf("gitremote: unsupported url %q", raw)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	i := strings.LastIndex(path, "/")
+	if host == "" || i <= 0 || i == len(path)-1 {
+		return nil, fmt.Errorf("gitremote: no owner/name in %q", raw)
+	}
+	host = strings.ToLower(host)
+	return &Repo{Type: repoTypes[host], Host: host, Owner: path[:i], Name: path[i+1:]}, nil
+}
+
+// ---------------------------------------------------------------------------------------
+
+// FindGitDir returns the git directory of the checkout containing dir. A
+// .git file, as used by worktrees and submodules, is followed.
+func FindGitDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		p := filepath.Join(dir, ".git")
+		fi, err := os.Stat(p)
+		if err == nil {
+			if fi.IsDir() {
+				return p, nil
+			}
+			return readGitFile(p)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNotRepo
+		}
+		dir = parent
+	}
+}
+
+func readGitFile(p string) (string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(s, "gitdir:") {
+		return "", fmt.Errorf("gitremote: bad %s", p)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(s, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(p), gitDir)
+	}
+	return gitDir, nil
+}
+
+// commonDir returns the directory holding the config of gitDir, which for a
+// worktree is the git directory of the main checkout.
+func commonDir(gitDir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	dir := strings.TrimSpace(string(b))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitDir, dir)
+	}
+	return dir
+}
+
+// Remotes returns the remotes of the config of gitDir, origin first.
+func Remotes(gitDir string) ([]*Remote, error) {
+	f, err := os.Open(filepath.Join(commonDir(gitDir), "config"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		remotes []*Remote
+		current *Remote
+	)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			current = nil
+			// [remote "origin"]
+			section := strings.Trim(line, "[]")
+			if strings.HasPrefix(section, "remote ") {
+				name := strings.Trim(strings.TrimSpace(section[len("remote "):]), `"`)
+				current = &Remote{Name: name}
+				if name == "origin" {
+					remotes = append([]*Remote{current}, remotes...)
+				} else {
+					remotes = append(remotes, current)
+				}
+			}
+			continue
+		}
+		if current == nil || current.URL != "" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "url") {
+			current.URL = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	out := remotes[:0]
+	for _, r := range remotes {
+		if r.URL != "" {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// Branch returns the branch HEAD of gitDir is on.
+func Branch(gitDir string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(head, "ref:") {
+		return "", ErrDetached
+	}
+	ref := strings.TrimSpace(strings.TrimPrefix(head, "ref:"))
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", ErrDetached
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), nil
+}
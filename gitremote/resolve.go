@@ -0,0 +1,87 @@
+package gitremote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Resolved is the project and branch of a checkout.
+type Resolved struct {
+	Project *kciClient.Project
+	Remote  *Remote
+	Repo    *Repo
+	Branch  string
+}
+
+// Match reports whether p builds repo. The repo types must agree when both
+// are known; the full name is compared ignoring case, and the clone url,
+// if any, must point to the same host.
+func Match(p *kciClient.Project, repo *Repo) bool {
+	if repo.Type != "" && p.RepoType != "" && repo.Type != p.RepoType {
+		return false
+	}
+	if p.RepoClone != "" {
+		if clone, err := ParseURL(p.RepoClone); err == nil {
+			return clone.Host == repo.Host && strings.EqualFold(clone.FullName(), repo.FullName())
+		}
+	}
+	full := p.RepoFullName
+	if full == "" {
+		full = p.RepoOwner + "/" + p.RepoName
+	}
+	return strings.EqualFold(full, repo.FullName())
+}
+
+// Resolve finds the project of the checkout containing dir among the
+// projects of c, trying the remotes origin first. Remotes on hosts of
+// unknown type, e.g. a self-hosted GitLab, are taken to be of defaultType
+// if it is set. The branch is that of HEAD; a detached HEAD is reported as
+// ErrDetached with the project still resolved.
+func Resolve(c kciClient.Client, dir, defaultType string) (*Resolved, error) {
+	gitDir, err := FindGitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	remotes, err := Remotes(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(remotes) == 0 {
+		return nil, fmt.Errorf("gitremote: %s has no remotes", gitDir)
+	}
+	projs, err := c.ProjList()
+	if err != nil {
+		return nil, err
+	}
+
+	var res *Resolved
+	for _, remote := range remotes {
+		repo, err := ParseURL(remote.URL)
+		if err != nil {
+			continue
+		}
+		if repo.Type == "" {
+			repo.Type = defaultType
+		}
+		for _, p := range projs {
+			if Match(p, repo) {
+				res = &Resolved{Project: p, Remote: remote, Repo: repo}
+				break
+			}
+		}
+		if res != nil {
+			break
+		}
+	}
+	if res == nil {
+		names := make([]string, len(remotes))
+		for i, r := range remotes {
+			names[i] = r.URL
+		}
+		return nil, fmt.Errorf("gitremote: no project builds %s", strings.Join(names, ", "))
+	}
+	res.Branch, err = Branch(gitDir)
+	return res, err
+}
@@ -0,0 +1,70 @@
+package kciClient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// headerContentSha1 carries the sha1 of an artifact upload. Being an X-Qiniu-
+// header it is signed, which binds the unsigned raw body to the signature.
+const headerContentSha1 = "X-Qiniu-Content-Sha1"
+
+// checkArtifactName rejects names the mac signature cannot tell apart: the
+// signature covers the unescaped path, where a / in a name looks like a path
+// separator.
+func checkArtifactName(name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("kci: invalid artifact name %q", name)
+	}
+	return nil
+}
+
+// checksum returns the hex sha1 of r and a reader yielding r from the start.
+// Seekable readers are rewound, others are spooled to a temporary file that
+// is removed when the returned reader is closed.
+func checksum(r io.Reader) (string, io.ReadCloser, error) {
+	h := sha1.New()
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			if _, err := io.Copy(h, rs); err != nil {
+				return "", nil, err
+			}
+			if _, err := rs.Seek(start, io.SeekStart); err != nil {
+				return "", nil, err
+			}
+			return hex.EncodeToString(h.Sum(nil)), ioutil.NopCloser(rs), nil
+		}
+	}
+
+	f, err := ioutil.TempFile("", "kci-artifact-")
+	if err != nil {
+		return "", nil, err
+	}
+	spool := &tempFile{f}
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		spool.Close()
+		return "", nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		spool.Close()
+		return "", nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), spool, nil
+}
+
+// tempFile removes the file when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
@@ -0,0 +1,124 @@
+package kciClient
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestClient returns a client talking plain http to a test server.
+func newTestClient(t *testing.T, h http.Handler) (Client, *httptest.Server) {
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	c := NewClientWithConfig(&ClientConfig{
+		Host:       strings.TrimPrefix(ts.URL, "http://"),
+		Scheme:     "http",
+		AK:         "ak",
+		SK:         "sk",
+		APIVersion: "v1",
+	})
+	return c, ts
+}
+
+func TestArtifactDownload(t *testing.T) {
+	const content = "0123456789"
+	tests := []struct {
+		name       string
+		offset     int64
+		honorRange bool
+		want       string
+	}{
+		{"whole", 0, true, content},
+		{"range honored", 4, true, "456789"},
+		{"range ignored", 4, false, "456789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.EscapedPath()
+				if rng := r.Header.Get("Range"); rng != "" && tt.honorRange {
+					var from int
+					fmt.Sscanf(rng, "bytes=%d-", &from)
+					w.WriteHeader(http.StatusPartialContent)
+					w.Write([]byte(content[from:]))
+					return
+				}
+				w.Write([]byte(content))
+			}))
+			var buf bytes.Buffer
+			n, err := c.ArtifactDownload(1, 2, "a b+c.tgz", &buf, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want || n != int64(len(tt.want)) {
+				t.Errorf("got %q (%d bytes), want %q", buf.String(), n, tt.want)
+			}
+			if want := "/v1/build/1/2/artifact/a%20b+c.tgz"; gotPath != want {
+				t.Errorf("path %s, want %s", gotPath, want)
+			}
+		})
+	}
+}
+
+// onlyReader hides the Seek method of the readers it wraps.
+type onlyReader struct {
+	r *strings.Reader
+}
+
+func (o onlyReader) Read(p []byte) (int, error) { return o.r.Read(p) }
+
+func TestArtifactUpload(t *testing.T) {
+	const content = "artifact body"
+	tests := []struct {
+		name string
+		body func() io.Reader
+	}{
+		{"seekable", func() io.Reader { return strings.NewReader(content) }},
+		{"spooled", func() io.Reader { return onlyReader{strings.NewReader(content)} }},
+	}
+	mac := NewMac("ak", "sk")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := mac.VerifyRequest(r); err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				body, _ := ioutil.ReadAll(r.Body)
+				sum := sha1.Sum(body)
+				if r.Header.Get(headerContentSha1) != hex.EncodeToString(sum[:]) {
+					http.Error(w, "checksum mismatch", http.StatusBadRequest)
+					return
+				}
+				fmt.Fprintf(w, `{"name":"out.tgz","size":%d,"jobNumber":%s}`, len(body), r.URL.Query().Get("job"))
+			}))
+			a, err := c.ArtifactUpload(1, 2, 3, "out.tgz", tt.body())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Size != int64(len(content)) || a.JobNum != 3 {
+				t.Errorf("got %+v", a)
+			}
+		})
+	}
+}
+
+func TestArtifactName(t *testing.T) {
+	c, _ := newTestClient(t, http.NotFoundHandler())
+	for _, name := range []string{"", "dir/file"} {
+		if _, err := c.ArtifactDownload(1, 2, name, ioutil.Discard, 0); err == nil {
+			t.Errorf("download %q: no error", name)
+		}
+		if _, err := c.ArtifactUpload(1, 2, 3, name, strings.NewReader("x")); err == nil {
+			t.Errorf("upload %q: no error", name)
+		}
+	}
+}
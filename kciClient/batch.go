@@ -0,0 +1,138 @@
+package kciClient
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const defaultBatchConcurrency = 4
+
+// BatchOptions controls the *Many helpers.
+type BatchOptions struct {
+	Concurrency int  // items processed at once, defaults to 4
+	DryRun      bool // report what would be done without calling the api
+}
+
+// BatchResult is the outcome of one item of a batch.
+type BatchResult struct {
+	Index   int // position of the item in the input
+	ProjId  int64
+	Branch  string   // BuildPostMany only
+	Project *Project // ProjPatchMany only
+	Build   *Build   // BuildPostMany only
+	Skipped bool     // dry run, nothing was done
+	Err     error
+}
+
+// BatchReport holds one result per item, in input order.
+type BatchReport struct {
+	Results []*BatchResult
+}
+
+// Failed returns the results with an error.
+func (r *BatchReport) Failed() []*BatchResult {
+	var out []*BatchResult
+	for _, res := range r.Results {
+		if res.Err != nil {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Err returns nil if every item succeeded, a *BatchError otherwise.
+func (r *BatchReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &BatchError{Total: len(r.Results), Failed: failed}
+}
+
+// BatchError lists the failed items of a batch.
+type BatchError struct {
+	Total  int
+	Failed []*BatchResult
+}
+
+func (e *BatchError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, res := range e.Failed {
+		msgs[i] = fmt.Sprintf("project %d: %v", res.ProjId, res.Err)
+	}
+	return fmt.Sprintf("%d of %d failed: %s", len(e.Failed), e.Total, strings.Join(msgs, "; "))
+}
+
+// runBatch calls fn for every result with bounded concurrency.
+func runBatch(results []*BatchResult, opt *BatchOptions, fn func(res *BatchResult)) *BatchReport {
+	if opt == nil {
+		opt = &BatchOptions{}
+	}
+	if opt.DryRun {
+		for _, res := range results {
+			res.Skipped = true
+		}
+		return &BatchReport{Results: results}
+	}
+	n := opt.Concurrency
+	if n <= 0 {
+		n = defaultBatchConcurrency
+	}
+	var wg sync.WaitGroup
+	queue := make(chan *BatchResult)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for res := range queue {
+				fn(res)
+			}
+		}()
+	}
+	for _, res := range results {
+		queue <- res
+	}
+	close(queue)
+	wg.Wait()
+	return &BatchReport{Results: results}
+}
+
+func batchResults(ids []int64) []*BatchResult {
+	results := make([]*BatchResult, len(ids))
+	for i, id := range ids {
+		results[i] = &BatchResult{Index: i, ProjId: id}
+	}
+	return results
+}
+
+// ProjPatchMany applies the same settings to many projects.
+func ProjPatchMany(c Client, projIds []int64, p *PatchProj, opt *BatchOptions) *BatchReport {
+	return runBatch(batchResults(projIds), opt, func(res *BatchResult) {
+		res.Project, res.Err = c.ProjPatch(res.ProjId, p)
+	})
+}
+
+// ProjDelMany deletes many projects.
+func ProjDelMany(c Client, projIds []int64, opt *BatchOptions) *BatchReport {
+	return runBatch(batchResults(projIds), opt, func(res *BatchResult) {
+		res.Err = c.ProjDel(res.ProjId)
+	})
+}
+
+// BuildTarget is a branch of a project to build.
+type BuildTarget struct {
+	ProjId int64
+	Branch string
+}
+
+// BuildPostMany starts a build for every target.
+func BuildPostMany(c Client, targets []BuildTarget, opt *BatchOptions) *BatchReport {
+	results := make([]*BatchResult, len(targets))
+	for i, t := range targets {
+		results[i] = &BatchResult{Index: i, ProjId: t.ProjId, Branch: t.Branch}
+	}
+	return runBatch(results, opt, func(res *BatchResult) {
+		res.Build, res.Err = c.BuildPost(res.ProjId, res.Branch)
+	})
+}
@@ -0,0 +1,103 @@
+package kciClient
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProjDelMany(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     *BatchOptions
+		failing map[int64]bool
+		calls   int
+		failed  []int64
+	}{
+		{"all ok", nil, nil, 3, nil},
+		{"some fail", &BatchOptions{Concurrency: 2}, map[int64]bool{2: true, 3: true}, 3, []int64{2, 3}},
+		{"dry run", &BatchOptions{DryRun: true}, map[int64]bool{2: true}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMockClient()
+			m.ProjDelFunc = func(projId int64) error {
+				if tt.failing[projId] {
+					return errors.New("denied")
+				}
+				return nil
+			}
+			r := ProjDelMany(m, []int64{1, 2, 3}, tt.opt)
+			m.AssertNumberOfCalls(t, "ProjDel", tt.calls)
+			for i, res := range r.Results {
+				if res.Index != i || res.ProjId != int64(i+1) {
+					t.Errorf("result %d out of order: %+v", i, res)
+				}
+				if res.Skipped != (tt.opt != nil && tt.opt.DryRun) {
+					t.Errorf("result %d skipped %v", i, res.Skipped)
+				}
+			}
+			var failed []int64
+			for _, res := range r.Failed() {
+				failed = append(failed, res.ProjId)
+			}
+			if len(failed) != len(tt.failed) {
+				t.Fatalf("failed %v, want %v", failed, tt.failed)
+			}
+			err := r.Err()
+			if len(tt.failed) == 0 {
+				if err != nil {
+					t.Errorf("error %v", err)
+				}
+				return
+			}
+			be, ok := err.(*BatchError)
+			if !ok || be.Total != 3 || !strings.HasPrefix(err.Error(), "2 of 3 failed: project 2: denied") {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		inFlight, max int32
+	)
+	m := NewMockClient()
+	m.BuildPostFunc = func(projId int64, branch string) (*Build, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		mu.Lock()
+		if n > max {
+			max = n
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return &Build{ProjectId: projId, Branch: branch}, nil
+	}
+	var targets []BuildTarget
+	for i := 0; i < 10; i++ {
+		targets = append(targets, BuildTarget{ProjId: int64(i), Branch: "b"})
+	}
+	r := BuildPostMany(m, targets, &BatchOptions{Concurrency: 3})
+	if max > 3 || max < 2 {
+		t.Errorf("max concurrency %d, want 3", max)
+	}
+	for i, res := range r.Results {
+		if res.Build == nil || res.Build.ProjectId != int64(i) || res.Branch != "b" {
+			t.Errorf("result %d: %+v", i, res)
+		}
+	}
+
+	m.ProjPatchFunc = func(projId int64, p *PatchProj) (*Project, error) {
+		return &Project{ID: projId}, nil
+	}
+	r = ProjPatchMany(m, []int64{4, 5}, &PatchProj{}, nil)
+	if r.Err() != nil || r.Results[1].Project.ID != 5 {
+		t.Errorf("patch: %+v", r.Results[1])
+	}
+}
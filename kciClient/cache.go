@@ -0,0 +1,246 @@
+package kciClient
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CacheEntry is a cached response body with its validators.
+type CacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Body         []byte `json:"body"`
+	Permanent    bool   `json:"permanent,omitempty"` // never revalidated
+}
+
+// Cache stores responses keyed by account, method and url, so one cache can
+// be shared by clients of different access keys. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, e *CacheEntry)
+}
+
+// paths whose GET responses may be cached
+func cacheablePath(path string) bool {
+	switch path {
+	case "/{version}/user", "/{version}/user/{repoType}/repo", "/{version}/project", "/{version}/project/{proj}",
+		"/{version}/build/{proj}", "/{version}/build/{proj}/{num}", "/{version}/build/{proj}/{num}/{job}/log",
+		"/{version}/build/{proj}/{num}/artifact":
+		return true
+	}
+	return false
+}
+
+// cacheKey returns the key of a GET of u. Responses depend on the access key,
+// so the account is part of the key.
+func (c *client) cacheKey(u *url.URL) string {
+	return c.account() + " GET " + u.String()
+}
+
+func (c *client) cachedGet(req *http.Request, path string) (*http.Response, error) {
+	cache := c.config.Cache
+	key := c.cacheKey(req.URL)
+	entry, ok := cache.Get(key)
+	if ok && entry.Permanent {
+		return cachedResponse(req, entry), nil
+	}
+	if ok {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := c.sendLimited(req, path, false)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		if ok {
+			return cachedResponse(req, entry), nil
+		}
+		// nothing to revalidate, e.g. a proxy answered for us: ask again
+		// without conditions, the response must carry a body now.
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		if resp, err = c.sendLimited(req, path, false); err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			return nil, fmt.Errorf("kci: %s: 304 Not Modified without a cached response", req.URL)
+		}
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	e := &CacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         body,
+		Permanent:    c.permanent(path, req.URL, body),
+	}
+	if e.ETag != "" || e.LastModified != "" || e.Permanent {
+		cache.Set(key, e)
+	}
+	return resp, nil
+}
+
+// permanent reports whether a response never changes: a finished build, or
+// the log of a job of a build already cached as finished.
+func (c *client) permanent(path string, u *url.URL, body []byte) bool {
+	switch path {
+	case "/{version}/build/{proj}/{num}":
+		var b struct {
+			Status string `json:"status"`
+		}
+		return json.Unmarshal(body, &b) == nil && IsDone(b.Status)
+	case "/{version}/build/{proj}/{num}/{job}/log":
+		build := *u
+		build.Path = strings.TrimSuffix(u.Path, "/log")
+		build.Path = build.Path[:strings.LastIndex(build.Path, "/")]
+		e, ok := c.config.Cache.Get(c.cacheKey(&build))
+		return ok && e.Permanent
+	}
+	return false
+}
+
+func cachedResponse(req *http.Request, e *CacheEntry) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// ---------------------------------------------------------------------------------------
+
+type memoryCache struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCache returns an in-memory cache keeping the size most recently
+// used entries.
+func NewMemoryCache(size int) Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &memoryCache{size: size, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (m *memoryCache) Get(key string) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true
+}
+
+func (m *memoryCache) Set(key string, e *CacheEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memoryItem).entry = e
+		m.order.MoveToFront(el)
+		return
+	}
+	m.items[key] = m.order.PushFront(&memoryItem{key, e})
+	for m.order.Len() > m.size {
+		el := m.order.Back()
+		m.order.Remove(el)
+		delete(m.items, el.Value.(*memoryItem).key)
+	}
+}
+
+// ---------------------------------------------------------------------------------------
+
+type diskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a cache storing one file per entry in dir. Entries
+// are never evicted; remove the directory to clear it.
+func NewDiskCache(dir string) Cache {
+	return &diskCache{dir: dir}
+}
+
+func (d *diskCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (d *diskCache) Get(key string) (*CacheEntry, bool) {
+	data, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	e := new(CacheEntry)
+	if json.Unmarshal(data, e) != nil {
+		return nil, false
+	}
+	return e, true
+}
+
+// Set writes the entry to a temporary file first so readers never see a
+// partial entry. Errors are ignored: a failed write only costs a refetch.
+func (d *diskCache) Set(key string, e *CacheEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(d.dir, 0755) != nil {
+		return
+	}
+	f, err := ioutil.TempFile(d.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if os.Rename(f.Name(), d.path(key)) != nil {
+		os.Remove(f.Name())
+	}
+}
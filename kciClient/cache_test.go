@@ -0,0 +1,142 @@
+package kciClient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", &CacheEntry{Body: []byte("a")})
+	c.Set("b", &CacheEntry{Body: []byte("b")})
+	c.Get("a") // b is now the least recently used
+	c.Set("c", &CacheEntry{Body: []byte("c")})
+	c.Set("a", &CacheEntry{Body: []byte("a2")})
+
+	tests := []struct {
+		key  string
+		want string
+		ok   bool
+	}{
+		{"a", "a2", true},
+		{"b", "", false},
+		{"c", "c", true},
+	}
+	for _, tt := range tests {
+		e, ok := c.Get(tt.key)
+		if ok != tt.ok || (ok && string(e.Body) != tt.want) {
+			t.Errorf("Get(%s) = %v, %v", tt.key, e, ok)
+		}
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kci-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewDiskCache(dir + "/sub")
+	if _, ok := c.Get("k"); ok {
+		t.Error("empty cache hit")
+	}
+	want := &CacheEntry{ETag: `"1"`, LastModified: "yesterday", Body: []byte{0, 1, 2}, Permanent: true}
+	c.Set("k", want)
+	got, ok := c.Get("k")
+	if !ok || got.ETag != want.ETag || got.LastModified != want.LastModified || string(got.Body) != string(want.Body) || !got.Permanent {
+		t.Errorf("Get = %+v, %v", got, ok)
+	}
+	files, _ := ioutil.ReadDir(dir + "/sub")
+	if len(files) != 1 {
+		t.Errorf("%d files, want 1", len(files))
+	}
+}
+
+// cacheServer serves builds and their logs with ETags and counts the
+// requests and the 304s it sends.
+type cacheServer struct {
+	status        string
+	requests, not int32
+	ignoreETags   bool // always 304, as a broken proxy would
+}
+
+func (s *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	etag := `"` + s.status + `"`
+	inm := r.Header.Get("If-None-Match")
+	if inm == etag || (s.ignoreETags && inm == "" && atomic.LoadInt32(&s.not) == 0) {
+		atomic.AddInt32(&s.not, 1)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if strings.HasSuffix(r.URL.Path, "/log") {
+		fmt.Fprint(w, `[{"proc":"a","out":"x"}]`)
+		return
+	}
+	fmt.Fprintf(w, `{"number":1,"status":%q}`, s.status)
+}
+
+func TestCachedGet(t *testing.T) {
+	srv := &cacheServer{status: StatusRunning}
+	c, _ := newTestClient(t, srv)
+	cfg := c.(*client).config
+	cfg.Cache = NewMemoryCache(10)
+	c = NewClientWithConfig(cfg)
+
+	steps := []struct {
+		name     string
+		status   string
+		call     func() (string, error)
+		requests int32
+		not      int32
+	}{
+		{"first fetch", StatusRunning, func() (string, error) { b, err := c.BuildById(1, 1); return b.Status, err }, 1, 0},
+		{"revalidated", StatusRunning, func() (string, error) { b, err := c.BuildById(1, 1); return b.Status, err }, 2, 1},
+		{"changed", StatusSuccess, func() (string, error) { b, err := c.BuildById(1, 1); return b.Status, err }, 3, 1},
+		{"finished build is permanent", StatusSuccess, func() (string, error) { b, err := c.BuildById(1, 1); return b.Status, err }, 3, 1},
+		{"log of finished build", StatusSuccess, func() (string, error) { l, err := c.BuildLogs(1, 1, 1); return l[0].Out, err }, 4, 1},
+		{"log is permanent", StatusSuccess, func() (string, error) { l, err := c.BuildLogs(1, 1, 1); return l[0].Out, err }, 4, 1},
+	}
+	for _, s := range steps {
+		srv.status = s.status
+		if _, err := s.call(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if srv.requests != s.requests || srv.not != s.not {
+			t.Errorf("%s: %d requests, %d not modified; want %d, %d", s.name, srv.requests, srv.not, s.requests, s.not)
+		}
+	}
+
+	// another access key shares the cache but not its entries
+	other := *cfg
+	other.AK = "ak2"
+	if _, err := NewClientWithConfig(&other).BuildById(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if srv.requests != 5 {
+		t.Errorf("other account served from cache")
+	}
+}
+
+func TestCachedGetUnexpected304(t *testing.T) {
+	srv := &cacheServer{status: StatusRunning, ignoreETags: true}
+	c, _ := newTestClient(t, srv)
+	cfg := c.(*client).config
+	cfg.Cache = NewMemoryCache(10)
+	c = NewClientWithConfig(cfg)
+
+	b, err := c.BuildById(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Status != StatusRunning || srv.requests != 2 {
+		t.Errorf("got %+v after %d requests", b, srv.requests)
+	}
+}
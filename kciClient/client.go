@@ -2,47 +2,100 @@ package kciClient
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"github.com/gorilla/websocket"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
+// api paths are relative to the versioned base url, websocket paths to the
+// websocket base url.
 const (
-	pathSelf          = "%s/v1/user"
-	pathRepo          = "%s/v1/user/%s/repo"
-	pathProj          = "%s/v1/project"
-	pathCheckProjName = "%s/v1/info/checkname/%s"
-	pathProjById      = "%s/v1/project/%d"
-	pathBuild         = "%s/v1/build/%d/%s"
-	pathBuildList     = "%s/v1/build/%d"
-	pathBuildById     = "%s/v1/build/%d/%d"
-	pathBuildLogById  = "%s/v1/build/%d/%d/%d/log"
-	pathAuth          = "%s/v1/%s/auth"
+	pathSelf          = "%s/user"
+	pathRepo          = "%s/user/%s/repo"
+	pathProj          = "%s/project"
+	pathCheckProjName = "%s/info/checkname/%s"
+	pathProjById      = "%s/project/%d"
+	pathBuild         = "%s/build/%d/%s"
+	pathBuildList     = "%s/build/%d"
+	pathBuildById     = "%s/build/%d/%d"
+	pathBuildLogById  = "%s/build/%d/%d/%d/log"
+	pathArtifactList  = "%s/build/%d/%d/artifact"
+	pathArtifact      = "%s/build/%d/%d/artifact/%s"
+	pathArtifactJob   = "%s/build/%d/%d/artifact/%s?job=%d"
+	pathAuth          = "%s/%s/auth"
+	pathCapabilities  = "%s/capabilities"
 	pathFeedWs        = "%s/ws/feed/%d"
 	pathRealLogs      = "%s/ws/log/%d/%d/%d"
-
-	httpScheme = "https://"
-	wsScheme   = "wss://"
 )
 
 type client struct {
 	client *http.Client
 	base   string // base url
 	wsbase string
+	prefix string // path of the base url, e.g. /kci
 	config *ClientConfig
+	limits *rateLimiter
+	ws     WsTransport
+	err    error // invalid network settings, returned by every call
+
+	mu           sync.Mutex
+	version      string    // negotiated api version
+	versionUntil time.Time // when a fallback version expires, zero for a negotiated one
 }
 
 type ClientConfig struct {
 	Host      string
+	BaseURL   string // e.g. https://example.com/kci, overrides Host and Scheme
 	AK        string
 	SK        string
 	Transport http.RoundTripper
 	UserAgent string
+	Hook      Hook // optional, observes every request and websocket
+
+	// APIVersion pins the api version, e.g. v1. If empty the newest version
+	// supported by both the server and the SDK is used, see Capabilities.
+	APIVersion string
+
+	// WsTransport opens the websockets of FeedWs and LogWs, defaults to a
+	// transport built from the network settings below.
+	WsTransport WsTransport
+
+	// Cache, if set, caches GET responses and revalidates them with
+	// If-None-Match/If-Modified-Since. Finished builds and their logs are
+	// served from the cache without asking the server again.
+	Cache Cache
+
+	// RateLimit, if set, throttles requests on the client side.
+	RateLimit *RateLimit
+
+	// Logger, if set, logs every request and response with secrets
+	// redacted. Verbose also logs the canonical string that is signed.
+	Logger  Logger
+	Verbose bool
+
+	// Scheme is "https" or "http", defaults to "https". Websockets use
+	// wss or ws accordingly.
+	Scheme string
+
+	// The settings below build the transports when Transport or
+	// WsTransport are nil, and are ignored otherwise. TLSConfig is cloned
+	// and CAFile, CertFile/KeyFile and InsecureSkipVerify applied on top.
+	TLSConfig          *tls.Config
+	CAFile             string // PEM bundle replacing the system roots
+	CertFile           string // client certificate
+	KeyFile            string
+	InsecureSkipVerify bool
+	Proxy              string        // proxy url, defaults to the environment proxy
+	DialTimeout        time.Duration // defaults to 30s
+	HandshakeTimeout   time.Duration // TLS and websocket handshake, defaults to 10s
 }
 
 // NewClient returns a client at the specified url.
@@ -58,16 +111,50 @@ func NewClient(host, ak, sk string) Client {
 
 // NewClient returns a client at the specified url.
 func NewClientWithConfig(config *ClientConfig) Client {
-	c := &client{base: httpScheme + config.Host, wsbase: wsScheme + config.Host, config: config}
+	c := &client{config: config}
+	base, wsbase, err := config.baseURLs()
+	c.base, c.wsbase = base.String(), wsbase.String()
+	c.prefix = base.EscapedPath()
+	transport, ws, err2 := config.transports()
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		// keep the client usable as a value, every call reports the error
+		c.err = err
+		transport, ws = http.DefaultTransport, DefaultWsTransport
+	}
+	if config.Logger != nil {
+		transport = newDebugTransport(config, transport)
+	}
 	m := NewMac(config.AK, config.SK)
-	c.client = NewMacClient(m, config.Transport)
+	c.client = NewMacClient(m, transport)
+	c.ws = ws
+	c.limits = newRateLimiter(config.RateLimit)
 	return c
 }
 
+// AccountKey identifies the server and access key c talks to, for keying
+// data cached on behalf of c. It is a hash, so it can be used in file names
+// without revealing the key. Clients other than those of NewClient have an
+// empty key.
+func AccountKey(c Client) string {
+	cc, ok := c.(*client)
+	if !ok {
+		return ""
+	}
+	return cc.account()
+}
+
+func (c *client) account() string {
+	sum := sha1.Sum([]byte(c.base + "\n" + c.config.AK))
+	return hex.EncodeToString(sum[:8])
+}
+
 // 返回用户信息（绑定的子帐户信息）
 func (c *client) Self() ([]*User, error) {
 	var out []*User
-	uri := fmt.Sprintf(pathSelf, c.base)
+	uri := fmt.Sprintf(pathSelf, c.api())
 	err := c.get(uri, &out)
 	return out, err
 }
@@ -75,7 +162,7 @@ func (c *client) Self() ([]*User, error) {
 // 获取仓库列表
 func (c *client) RepoList(repoType string) ([]*Repo, error) {
 	var out []*Repo
-	uri := fmt.Sprintf(pathRepo, c.base, repoType)
+	uri := fmt.Sprintf(pathRepo, c.api(), repoType)
 	err := c.get(uri, &out)
 	return out, err
 }
@@ -83,7 +170,7 @@ func (c *client) RepoList(repoType string) ([]*Repo, error) {
 // 创建项目
 func (c *client) ProjPost(req *CreateProjReq) (*Project, error) {
 	out := new(Project)
-	uri := fmt.Sprintf(pathProj, c.base)
+	uri := fmt.Sprintf(pathProj, c.api())
 	err := c.post(uri, req, &out)
 	return out, err
 }
@@ -91,7 +178,7 @@ func (c *client) ProjPost(req *CreateProjReq) (*Project, error) {
 // 获取项目列表
 func (c *client) ProjList() ([]*Project, error) {
 	var out []*Project
-	uri := fmt.Sprintf(pathProj, c.base)
+	uri := fmt.Sprintf(pathProj, c.api())
 	err := c.get(uri, &out)
 	return out, err
 }
@@ -99,7 +186,7 @@ func (c *client) ProjList() ([]*Project, error) {
 // 获取项目
 func (c *client) Proj(projId int64) (*Project, error) {
 	out := new(Project)
-	uri := fmt.Sprintf(pathProjById, c.base, projId)
+	uri := fmt.Sprintf(pathProjById, c.api(), projId)
 	err := c.get(uri, &out)
 	return out, err
 }
@@ -107,14 +194,14 @@ func (c *client) Proj(projId int64) (*Project, error) {
 // 更新项目设置
 func (c *client) ProjPatch(projId int64, p *PatchProj) (*Project, error) {
 	out := new(Project)
-	uri := fmt.Sprintf(pathProjById, c.base, projId)
+	uri := fmt.Sprintf(pathProjById, c.api(), projId)
 	err := c.post(uri, p, &out)
 	return out, err
 }
 
 // 删除项目
 func (c *client) ProjDel(projId int64) error {
-	uri := fmt.Sprintf(pathProjById, c.base, projId)
+	uri := fmt.Sprintf(pathProjById, c.api(), projId)
 	err := c.delete(uri)
 	return err
 }
@@ -122,7 +209,7 @@ func (c *client) ProjDel(projId int64) error {
 // 手动构建
 func (c *client) BuildPost(projId int64, branch string) (*Build, error) {
 	out := new(Build)
-	uri := fmt.Sprintf(pathBuild, c.base, projId, branch)
+	uri := fmt.Sprintf(pathBuild, c.api(), projId, branch)
 	err := c.post(uri, nil, &out)
 	return out, err
 }
@@ -130,7 +217,7 @@ func (c *client) BuildPost(projId int64, branch string) (*Build, error) {
 // 获取构建历史
 func (c *client) BuildList(projId int64) ([]*Build, error) {
 	var out []*Build
-	uri := fmt.Sprintf(pathBuildList, c.base, projId)
+	uri := fmt.Sprintf(pathBuildList, c.api(), projId)
 	err := c.get(uri, &out)
 	return out, err
 }
@@ -138,7 +225,7 @@ func (c *client) BuildList(projId int64) ([]*Build, error) {
 // 获取单次的构建
 func (c *client) BuildById(projId int64, buildId int) (*Build, error) {
 	out := new(Build)
-	uri := fmt.Sprintf(pathBuildById, c.base, projId, buildId)
+	uri := fmt.Sprintf(pathBuildById, c.api(), projId, buildId)
 	err := c.get(uri, &out)
 	return out, err
 }
@@ -146,14 +233,14 @@ func (c *client) BuildById(projId int64, buildId int) (*Build, error) {
 // 获取某次构建的日志
 func (c *client) BuildLogs(projId int64, buildId, jobNum int) ([]*Log, error) {
 	var out []*Log
-	uri := fmt.Sprintf(pathBuildLogById, c.base, projId, buildId, jobNum)
+	uri := fmt.Sprintf(pathBuildLogById, c.api(), projId, buildId, jobNum)
 	err := c.get(uri, &out)
 	return out, err
 }
 
 // 解除绑定
 func (c *client) AuthDel(repoType string) error {
-	uri := fmt.Sprintf(pathAuth, c.base, repoType)
+	uri := fmt.Sprintf(pathAuth, c.api(), repoType)
 	err := c.delete(uri)
 	return err
 }
@@ -161,11 +248,71 @@ func (c *client) AuthDel(repoType string) error {
 // 检查项目名是否可用
 func (c *client) CheckProjName(name string) (*CheckProjNameRes, error) {
 	out := new(CheckProjNameRes)
-	uri := fmt.Sprintf(pathCheckProjName, c.base, name)
+	uri := fmt.Sprintf(pathCheckProjName, c.api(), name)
 	err := c.get(uri, &out)
 	return out, err
 }
 
+// 获取构建产物列表
+func (c *client) ArtifactList(projId int64, buildNum int) ([]*Artifact, error) {
+	var out []*Artifact
+	uri := fmt.Sprintf(pathArtifactList, c.api(), projId, buildNum)
+	err := c.get(uri, &out)
+	return out, err
+}
+
+// 下载构建产物, offset > 0 时通过 Range 请求断点续传
+func (c *client) ArtifactDownload(projId int64, buildNum int, name string, w io.Writer, offset int64) (int64, error) {
+	if err := checkArtifactName(name); err != nil {
+		return 0, err
+	}
+	uri := fmt.Sprintf(pathArtifact, c.api(), projId, buildNum, url.PathEscape(name))
+	var header http.Header
+	if offset > 0 {
+		header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}}
+	}
+	resp, err := c.stream(uri, "GET", header, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// the server ignored the range, skip what the caller already has.
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			return 0, err
+		}
+	}
+	return io.Copy(w, resp.Body)
+}
+
+// 上传构建产物
+func (c *client) ArtifactUpload(projId int64, buildNum, jobNum int, name string, r io.Reader) (*Artifact, error) {
+	if err := checkArtifactName(name); err != nil {
+		return nil, err
+	}
+	// raw bodies are not part of the mac signature, their sha1 is sent in a
+	// signed X-Qiniu- header instead.
+	sum, body, err := checksum(r)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	header := http.Header{headerContentSha1: {sum}}
+
+	out := new(Artifact)
+	uri := fmt.Sprintf(pathArtifactJob, c.api(), projId, buildNum, url.PathEscape(name), jobNum)
+	// hide any Write method (e.g. *os.File) so the body is sent raw
+	// rather than buffered as plain text.
+	resp, err := c.stream(uri, "PUT", header, struct{ io.Reader }{body})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(out)
+	return out, err
+}
+
 //
 func (p *client) FeedWs(userid uint64) (<-chan []byte, error) {
 	uri := fmt.Sprintf(pathFeedWs, p.wsbase, userid)
@@ -178,45 +325,54 @@ func (p *client) LogWs(projId int64, num, job int) (<-chan []byte, error) {
 }
 
 func (p *client) wsMessages(uri string) (<-chan []byte, error) {
-	dailer := &websocket.Dialer{
-		Proxy: http.ProxyFromEnvironment,
-	}
 	header := make(http.Header)
 	if p.config.UserAgent != "" {
 		header["User-Agent"] = []string{p.config.UserAgent}
 	}
-	c, _, err := dailer.Dial(uri, header)
+	if p.err != nil {
+		return nil, p.err
+	}
+	// a dial counts as a request; the connection itself holds no slot.
+	release := p.limits.acquire(pathTemplate(p.prefix, "GET", uri))
+	in, err := p.ws.Dial(uri, header)
+	release()
+	ev := p.wsEvent(uri)
 	if err != nil {
+		ev(WsConnect, 0, err)
 		return nil, err
 	}
-	msg := make(chan []byte, 10)
+	ev(WsConnect, 0, nil)
+	if p.config.Hook == nil {
+		return in, nil
+	}
 
+	msg := make(chan []byte, 10)
 	go func() {
-		defer c.Close()
 		defer close(msg)
-		for {
-			_, message, err := c.ReadMessage()
-			if err != nil {
-				return
-			}
+		for message := range in {
+			ev(WsMessage, len(message), nil)
 			msg <- message
 		}
+		ev(WsDisconnect, 0, nil)
 	}()
+	return msg, nil
+}
 
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				c.SetWriteDeadline(time.Now().Add(10 * time.Second))
-				if err := c.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-					return
-				}
-			}
+// returns a function reporting events of one websocket connection to the
+// hook, or doing nothing when there is no hook.
+func (p *client) wsEvent(uri string) func(t WsEventType, n int, err error) {
+	hook := p.config.Hook
+	if hook == nil {
+		return func(WsEventType, int, error) {}
+	}
+	id, path, start := nextWsConnID(), pathTemplate(p.prefix, "GET", uri), time.Now()
+	return func(t WsEventType, n int, err error) {
+		ev := &WsEvent{Type: t, ID: id, Path: path, URL: uri, Bytes: n, Err: err}
+		if t == WsDisconnect {
+			ev.Duration = time.Since(start)
 		}
-	}()
-	return msg, nil
+		hook.WsEvent(ev)
+	}
 }
 
 //
@@ -250,24 +406,29 @@ func (c *client) delete(rawurl string) error {
 
 // helper function to make an http request
 func (c *client) do(rawurl, method string, in, out interface{}) error {
-	// executes the http request and returns the body as
-	// and io.ReadCloser
-	body, err := c.stream(rawurl, method, in, out)
+	// executes the http request and returns the response,
+	// whose body is an io.ReadCloser
+	resp, err := c.stream(rawurl, method, nil, in)
 	if err != nil {
 		return err
 	}
-	defer body.Close()
+	defer resp.Body.Close()
 
 	// if a json response is expected, parse and return
 	// the json response.
 	if out != nil {
-		return json.NewDecoder(body).Decode(out)
+		return json.NewDecoder(resp.Body).Decode(out)
 	}
 	return nil
 }
 
-// helper function to stream an http request
-func (c *client) stream(rawurl, method string, in, out interface{}) (io.ReadCloser, error) {
+// helper function to stream an http request with optional extra request
+// headers. the whole response is returned so that callers can inspect status
+// and headers, also along with the error of a non 2xx status.
+func (c *client) stream(rawurl, method string, header http.Header, in interface{}) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	uri, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, err
@@ -275,43 +436,133 @@ func (c *client) stream(rawurl, method string, in, out interface{}) (io.ReadClos
 
 	// if we are posting or putting data, we need to
 	// write it to the body of the request.
-	var buf io.ReadWriter
+	var buf io.Reader
 	if in == nil {
 		// nothing
 	} else if rw, ok := in.(io.ReadWriter); ok {
 		buf = rw
+	} else if r, ok := in.(io.Reader); ok {
+		buf = r
 	} else {
-		buf = new(bytes.Buffer)
-		err := json.NewEncoder(buf).Encode(in)
+		jbuf := new(bytes.Buffer)
+		err := json.NewEncoder(jbuf).Encode(in)
 		if err != nil {
 			return nil, err
 		}
+		buf = jbuf
 	}
 
 	// creates a new http request to bitbucket.
 	req, err := http.NewRequest(method, uri.String(), buf)
+	if err != nil {
+		return nil, err
+	}
 	if c.config.UserAgent != "" {
 		req.Header.Set("User-Agent", c.config.UserAgent)
 	}
-	if err != nil {
-		return nil, err
+	for k, v := range header {
+		req.Header[k] = v
 	}
 	if in == nil {
 		// nothing
 	} else if _, ok := in.(io.ReadWriter); ok {
 		req.Header.Set("Content-Type", "plain/text")
+	} else if _, ok := in.(io.Reader); ok {
+		// raw bodies are not part of the mac signature
+		req.Header.Set("Content-Type", "application/octet-stream")
 	} else {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
+	path := pathTemplate(c.prefix, method, rawurl)
+	if c.config.Cache != nil && method == "GET" && len(header) == 0 && cacheablePath(path) {
+		return c.cachedGet(req, path)
+	}
+	return c.sendLimited(req, path, buf != nil)
+}
+
+// helper function to send a request once the rate limiter allows it, and
+// again after a 429 once its Retry-After has passed. the limiter slot is
+// held until the response body is closed.
+func (c *client) sendLimited(req *http.Request, path string, hasBody bool) (*http.Response, error) {
+	for n := 0; ; n++ {
+		// wait for the rate limiter before the request is signed and sent.
+		release := c.limits.acquire(path)
+		resp, err := c.send(req, path, hasBody)
+		if err != nil {
+			release()
+			if next, ok := c.limits.retry(req, resp, n); ok {
+				req = next
+				continue
+			}
+			return resp, err
+		}
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		return resp, nil
+	}
+}
+
+// helper function to send a request, reporting it to the hook if any.
+func (c *client) send(req *http.Request, path string, hasBody bool) (*http.Response, error) {
+	hook := c.config.Hook
+	if hook == nil {
+		return c.do2xx(req, path)
+	}
+	info := &RequestInfo{
+		Method:   req.Method,
+		Path:     path,
+		URL:      req.URL.String(),
+		BytesOut: req.ContentLength,
+	}
+	if hasBody && req.ContentLength == 0 {
+		info.BytesOut = -1
+	}
+	hook.BeforeRequest(info)
+	start := time.Now()
+	resp, err := c.do2xx(req, path)
+	if resp != nil {
+		info.Status = resp.StatusCode
+	}
+	if err != nil {
+		info.Err = err
+		info.Duration = time.Since(start)
+		hook.AfterRequest(info)
+		return resp, err
+	}
+	resp.Body = &hookedBody{ReadCloser: resp.Body, hook: hook, info: info, start: start}
+	return resp, nil
+}
+
+// helper function to send a request, turning non 2xx responses into errors.
+// the response is also returned on error when one was received.
+func (c *client) do2xx(req *http.Request, path string) (*http.Response, error) {
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode > http.StatusPartialContent {
+	c.limits.observe(path, resp)
+	if resp.StatusCode > http.StatusPartialContent && resp.StatusCode != http.StatusNotModified {
 		defer resp.Body.Close()
 		out, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf(string(out))
+		return resp, &APIError{StatusCode: resp.StatusCode, Message: string(out)}
 	}
-	return resp.Body, nil
+	return resp, nil
+}
+
+// APIError is returned for a request the server answered with an error
+// status. Its message is the body of the response.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// IsClientError reports whether err is an APIError with a 4xx status other
+// than 429, a request the server refused rather than failed to serve.
+func IsClientError(err error) bool {
+	e, ok := err.(*APIError)
+	return ok && e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusTooManyRequests
 }
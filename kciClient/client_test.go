@@ -0,0 +1,36 @@
+package kciClient
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		code   int
+		client bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusConflict, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.code)
+			w.Write([]byte("project name exists"))
+		}))
+		_, err := c.CheckProjName("p")
+		e, ok := err.(*APIError)
+		if !ok || e.StatusCode != tt.code || e.Error() != "project name exists" {
+			t.Errorf("%d: got %#v", tt.code, err)
+		}
+		if got := IsClientError(err); got != tt.client {
+			t.Errorf("%d: IsClientError %v, want %v", tt.code, got, tt.client)
+		}
+	}
+	if IsClientError(errors.New("connection refused")) {
+		t.Error("a transport error is a client error")
+	}
+}
@@ -1,6 +1,7 @@
 package kciClient
 
-const kciHost = "kci.qiniu.com"
+// DefaultHost is the public kci service, used by contexts without a host.
+const DefaultHost = "kci.qiniu.com"
 const sdkVersion = "1.0"
 
 // your ak sk from portal
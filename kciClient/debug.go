@@ -0,0 +1,129 @@
+package kciClient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDebugBody is how much of a request or response body is logged.
+const maxDebugBody = 1024
+
+const redacted = "[REDACTED]"
+
+// Logger is where debug output goes; *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+var (
+	// headers never logged verbatim
+	secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	// json fields whose values are never logged
+	secretFieldRe = regexp.MustCompile(`(?i)("(?:[^"]*(?:secret|password|passwd|token)[^"]*|sk)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// debugTransport logs requests after they are signed, and their responses.
+type debugTransport struct {
+	logger    Logger
+	verbose   bool
+	sk        string
+	Transport http.RoundTripper
+}
+
+func newDebugTransport(config *ClientConfig, t http.RoundTripper) *debugTransport {
+	return &debugTransport{logger: config.Logger, verbose: config.Verbose, sk: config.SK, Transport: t}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.verbose {
+		data, err := canonicalRequest(req)
+		if err != nil {
+			t.logger.Printf("kci: --> signed string: %v", err)
+		} else {
+			t.logger.Printf("kci: --> signed string:\n%s", t.redact(truncate(data)))
+		}
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, req.Body, err = peek(req.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.logger.Printf("kci: --> %s %s\n%s%s", req.Method, req.URL, t.headers(req.Header), t.redact(body))
+
+	start := time.Now()
+	resp, err := t.Transport.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		t.logger.Printf("kci: <-- %s %s error after %v: %v", req.Method, req.URL, latency, err)
+		return nil, err
+	}
+
+	body, resp.Body, err = peek(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	t.logger.Printf("kci: <-- %s %s %s in %v\n%s%s", req.Method, req.URL, resp.Status, latency, t.headers(resp.Header), t.redact(body))
+	return resp, nil
+}
+
+func (t *debugTransport) headers(h http.Header) string {
+	var keys []string
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		v := strings.Join(h[k], ", ")
+		for _, s := range secretHeaders {
+			if http.CanonicalHeaderKey(k) == s {
+				v = redacted
+			}
+		}
+		fmt.Fprintf(buf, "%s: %s\n", k, t.redact([]byte(v)))
+	}
+	return buf.String()
+}
+
+// redact hides secret json values and any occurrence of the secret key.
+func (t *debugTransport) redact(b []byte) string {
+	s := secretFieldRe.ReplaceAllString(string(b), `$1"`+redacted+`"`)
+	if t.sk != "" {
+		s = strings.Replace(s, t.sk, redacted, -1)
+	}
+	return s
+}
+
+// peek reads up to maxDebugBody bytes from r and returns them, truncated for
+// display, along with a reader that still yields the whole body.
+func peek(r io.ReadCloser) ([]byte, io.ReadCloser, error) {
+	head, err := ioutil.ReadAll(io.LimitReader(r, maxDebugBody+1))
+	if err != nil {
+		return nil, r, err
+	}
+	rest := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r), r}
+	return truncate(head), rest, nil
+}
+
+func truncate(b []byte) []byte {
+	if len(b) <= maxDebugBody {
+		return b
+	}
+	out := append([]byte{}, b[:maxDebugBody]...)
+	return append(out, "...(truncated)"...)
+}
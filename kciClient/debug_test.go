@@ -0,0 +1,81 @@
+package kciClient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bufLogger collects debug output.
+type bufLogger struct {
+	mu  sync.Mutex
+	out []string
+}
+
+func (l *bufLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	l.out = append(l.out, fmt.Sprintf(format, v...))
+	l.mu.Unlock()
+}
+
+func (l *bufLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.out, "\n")
+}
+
+func TestRedact(t *testing.T) {
+	d := &debugTransport{sk: "s3cr3t"}
+	tests := []struct {
+		in, want string
+	}{
+		{`{"name":"x"}`, `{"name":"x"}`},
+		{`{"sk":"abc","ak":"pub"}`, `{"sk":"[REDACTED]","ak":"pub"}`},
+		{`{"Password" : "a\"b", "apiToken":"t"}`, `{"Password" : "[REDACTED]", "apiToken":"[REDACTED]"}`},
+		{`{"clientSecret":"","skip":"no"}`, `{"clientSecret":"[REDACTED]","skip":"no"}`},
+		{`raw s3cr3t text`, `raw [REDACTED] text`},
+	}
+	for _, tt := range tests {
+		if got := d.redact([]byte(tt.in)); got != tt.want {
+			t.Errorf("redact(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDebugTransport(t *testing.T) {
+	big := strings.Repeat("x", 2*maxDebugBody)
+	var got string
+	c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		got = string(b)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie-value"})
+		fmt.Fprintf(w, `{"id":1,"repoName":"%s"}`, big)
+	}))
+	cfg := c.(*client).config
+	cfg.SK = "sk-value"
+	logger := new(bufLogger)
+	cfg.Logger, cfg.Verbose = logger, true
+	c = NewClientWithConfig(cfg)
+
+	p, err := c.ProjPost(&CreateProjReq{RepoName: "r", RepoOwner: "sk-value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.RepoName != big || !strings.Contains(got, "sk-value") {
+		t.Error("body altered by logging")
+	}
+	out := logger.String()
+	for _, secret := range []string{"sk-value", "cookie-value", "Qiniu ak:"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"signed string:", "--> POST", "<-- POST", "200 OK", "...(truncated)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package kciClient
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+const defaultTimeout = 60
+const defaultPrActive = false
+const defaultPushActive = true
+const defaultDeployActive = true
+const defaultTagsActive = false
+
+// !! warning !! test will del/add/mod projects, all projects of the account
+// are deleted first. It only runs against the context named by
+// $KCI_TEST_CONTEXT.
+func TestClient(t *testing.T) {
+	client := NewClientWithConfig(testConfig(t))
+	// !!! you should auth with portal first !!!
+	var projIdForBuildTest int64
+	var buildNum int
+
+	projs, err := client.ProjList()
+	assert(t, err == nil)
+	var ids []int64
+	for _, proj := range projs {
+		ids = append(ids, proj.ID)
+	}
+	report := ProjDelMany(client, ids, nil)
+	assert(t, report.Err() == nil)
+	req := &CreateProjReq{
+		ProjName:  "justtest",
+		RepoType:  "github",
+		RepoOwner: "u2takey",
+		RepoName:  "justtest",
+	}
+
+	proj, err := client.ProjPost(req)
+	assert(t, err == nil)
+
+	proj, err = client.Proj(proj.ID)
+	assert(t, err == nil)
+	assert(t, proj.ProjName == req.ProjName)
+	assert(t, proj.RepoType == req.RepoType)
+	assert(t, proj.RepoOwner == req.RepoOwner)
+	assert(t, proj.RepoName == req.RepoName)
+	projIdForBuildTest = proj.ID
+
+	// ------------------------------------------------
+	t.Run("Should get user count info", func(t *testing.T) {
+		users, err := client.Self()
+		assert(t, err == nil)
+		//Detail(users)
+		assert(t, len(users) > 0)
+	})
+
+	// ------------------------------------------------
+	t.Run("Should get user repos", func(t *testing.T) {
+		repos, err := client.RepoList("github")
+		assert(t, err == nil)
+		//Detail(repos)
+		assert(t, len(repos) > 0)
+	})
+
+	// ------------------------------------------------
+	t.Run("Should create and get projs", func(t *testing.T) {
+		projs, err := client.ProjList()
+		assert(t, err == nil)
+		// Detail(projs)
+		// should be 1
+		assert(t, len(projs) == 1)
+
+		req := &CreateProjReq{
+			ProjName:  "testname123",
+			RepoType:  "github",
+			RepoOwner: "u2takey",
+			RepoName:  "go-cache",
+		}
+		proj, err := client.ProjPost(req)
+		// should success
+		assert(t, err == nil)
+		// Detail(proj)
+		assert(t, proj.ProjName == req.ProjName)
+		assert(t, proj.RepoType == req.RepoType)
+		assert(t, proj.RepoOwner == req.RepoOwner)
+		assert(t, proj.RepoName == req.RepoName)
+
+		proj, err = client.ProjPost(req)
+		// should fail for repos exsit
+		assert(t, err != nil)
+
+		projs, err = client.ProjList()
+		assert(t, err == nil)
+		// Detail(projs)
+		// should have 2 projs
+		assert(t, len(projs) == 2)
+	})
+
+	// ------------------------------------------------
+	t.Run("Should not create projs", func(t *testing.T) {
+		req := &CreateProjReq{
+			ProjName:  "justtest",
+			RepoType:  "github",
+			RepoOwner: "u2takey",
+			RepoName:  "boom",
+		}
+		_, err := client.ProjPost(req)
+		// should fail for porj name exsit
+		assert(t, err != nil)
+
+		checkProjNameRes, err := client.CheckProjName(req.ProjName)
+		assert(t, err != nil)
+		assert(t, checkProjNameRes.Avaliable == false)
+
+		req = &CreateProjReq{
+			ProjName:  "testname",
+			RepoType:  "github",
+			RepoOwner: "u2takey",
+			RepoName:  "justtest",
+		}
+		_, err = client.ProjPost(req)
+		// should fail for repos exsit
+		assert(t, err != nil)
+
+	})
+
+	// ------------------------------------------------
+	t.Run("Should update project info ", func(t *testing.T) {
+		proj, err := client.Proj(projIdForBuildTest)
+		assert(t, err == nil)
+		// this is default config
+		assert(t, proj.Timeout == defaultTimeout)
+		assert(t, proj.PrActive == defaultPrActive)
+		assert(t, proj.PushActive == defaultPushActive)
+		assert(t, proj.DeployActive == defaultDeployActive)
+		assert(t, proj.TagsActive == defaultTagsActive)
+
+		patchReq := &PatchProj{}
+		var timeout int64 = 30
+		tagActive := true
+		patchReq.Timeout = &timeout
+		// Detail(patchReq)
+		patchReq.TagsActive = &tagActive
+
+		proj, err = client.ProjPatch(projIdForBuildTest, patchReq)
+		assert(t, err == nil)
+
+		assert(t, proj.Timeout == *patchReq.Timeout)
+		assert(t, proj.PrActive == defaultPrActive)
+		assert(t, proj.PushActive == defaultPushActive)
+		assert(t, proj.DeployActive == defaultDeployActive)
+		assert(t, proj.TagsActive == *patchReq.TagsActive)
+	})
+
+	// ------------------------------------------------
+	t.Run("Should post and get build info ", func(t *testing.T) {
+		proj, err := client.Proj(projIdForBuildTest)
+		assert(t, err == nil)
+		build, err := client.BuildPost(projIdForBuildTest, "default")
+		//Detail(build)
+		assert(t, err == nil)
+		assert(t, build.ProjectId == proj.ID)
+
+		builds, err := client.BuildList(projIdForBuildTest)
+		assert(t, err == nil)
+		//Detail(builds)
+		assert(t, len(builds) == 1)
+
+		buildDetail, err := client.BuildById(projIdForBuildTest, build.Number)
+		assert(t, err == nil)
+		//Detail(buildDetail)
+		assert(t, buildDetail.ProjectId == projIdForBuildTest)
+		assert(t, len(buildDetail.Jobs) > 0)
+
+		buildNum = build.Number
+	})
+
+	// ------------------------------------------------
+	// should get logs after build done
+	t.Logf("build %d of project %d left to finish", buildNum, projIdForBuildTest)
+	//logs, err := client.BuildLogs(projIdForBuildTest, buildNum, 0)
+	//assert(t, err == nil)
+	//assert(t, len(logs) > 0)
+}
+
+// testConfig returns the config of the context named by $KCI_TEST_CONTEXT
+// and skips the test without one: the test wipes the account, so it never
+// picks a context, or the ak/sk constants, on its own.
+func testConfig(t *testing.T) *ClientConfig {
+	name := os.Getenv("KCI_TEST_CONTEXT")
+	if name == "" {
+		t.Skip("KCI_TEST_CONTEXT not set, skipping test against a live account")
+	}
+	r, err := LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.Context(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Config()
+}
+
+func assert(t *testing.T, ok bool) {
+	t.Helper()
+	if !ok {
+		t.Fatal("assertion failed")
+	}
+}
+
+func Detail(v interface{}) {
+	buf, _ := json.MarshalIndent(v, "  ", " ")
+	fmt.Println(string(buf))
+}
@@ -0,0 +1,87 @@
+package kciClient
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// feedDedupSize bounds the events FollowFeed remembers to drop repeats.
+const feedDedupSize = 1000
+
+// FollowFeed calls fn for the builds pushed by FeedWs of userid until stop is
+// closed, reconnecting with backoff when the websocket drops or fails to
+// connect. Messages that are not build events are skipped, and a build
+// missing its ProjectId gets the id of the event's project.
+//
+// The feed repeats events; fn is called once per project, build and status.
+// If fn fails the event is not remembered, so a repeat retries it. Connect
+// errors and the errors of fn are passed to onErr, if set.
+func FollowFeed(c Client, userid uint64, stop <-chan struct{}, fn func(ev *FeedEvent) error, onErr func(err error)) {
+	f := &feedFollower{fn: fn, onErr: onErr, seen: map[string]bool{}}
+	backoff := time.Second
+	for {
+		msgs, err := c.FeedWs(userid)
+		if err == nil {
+			backoff = time.Second
+			f.consume(msgs, stop)
+		} else {
+			f.error(err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+type feedFollower struct {
+	fn    func(ev *FeedEvent) error
+	onErr func(err error)
+	seen  map[string]bool // proj/build/status already handled
+	keys  []string        // of seen in insertion order, to bound its size
+}
+
+func (f *feedFollower) consume(msgs <-chan []byte, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			ev := new(FeedEvent)
+			if json.Unmarshal(msg, ev) != nil || ev.Build == nil {
+				continue
+			}
+			if ev.Project != nil && ev.Build.ProjectId == 0 {
+				ev.Build.ProjectId = ev.Project.ID
+			}
+			key := fmt.Sprintf("%d/%d/%s", ev.Build.ProjectId, ev.Build.Number, ev.Build.Status)
+			if f.seen[key] {
+				continue
+			}
+			if err := f.fn(ev); err != nil {
+				f.error(err)
+				continue
+			}
+			f.seen[key] = true
+			f.keys = append(f.keys, key)
+			if len(f.keys) > feedDedupSize {
+				delete(f.seen, f.keys[0])
+				f.keys = f.keys[1:]
+			}
+		}
+	}
+}
+
+func (f *feedFollower) error(err error) {
+	if f.onErr != nil {
+		f.onErr(err)
+	}
+}
@@ -0,0 +1,84 @@
+package kciClient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFollowFeed(t *testing.T) {
+	m := NewMockClient()
+	msgs := make(chan []byte)
+	m.FeedWsFunc = func(userid uint64) (<-chan []byte, error) {
+		if len(m.CallsTo("FeedWs")) == 1 {
+			return nil, errors.New("401 unauthorized")
+		}
+		return msgs, nil
+	}
+	event := func(proj *Project, b Build) []byte {
+		msg, _ := json.Marshal(&FeedEvent{Project: proj, Build: &b})
+		return msg
+	}
+	p := &Project{ID: 1}
+
+	var (
+		got  []string
+		errs []string
+		fail = true
+	)
+	fn := func(ev *FeedEvent) error {
+		got = append(got, fmt.Sprintf("%d/%d/%s", ev.Build.ProjectId, ev.Build.Number, ev.Build.Status))
+		if ev.Build.Status == StatusFailure && fail {
+			fail = false
+			return errors.New("post failed")
+		}
+		return nil
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		FollowFeed(m, 7, stop, fn, func(err error) { errs = append(errs, err.Error()) })
+		close(done)
+	}()
+	for _, msg := range [][]byte{
+		event(p, Build{Number: 1, Status: StatusRunning}),
+		event(nil, Build{ProjectId: 1, Number: 1, Status: StatusRunning}), // repeated
+		[]byte("not json"),
+		[]byte(`{"project":{"id":1}}`),
+		event(p, Build{Number: 1, Status: StatusFailure}),
+		event(p, Build{Number: 1, Status: StatusFailure}), // retried, fn failed
+		event(p, Build{Number: 1, Status: StatusFailure}),
+		event(p, Build{Number: 2, Status: StatusRunning}),
+	} {
+		msgs <- msg
+	}
+	close(stop)
+	<-done
+
+	want := "[1/1/running 1/1/failure 1/1/failure 1/2/running]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if fmt.Sprint(errs) != "[401 unauthorized post failed]" {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestFeedDedupBounded(t *testing.T) {
+	var calls int
+	f := &feedFollower{fn: func(ev *FeedEvent) error { calls++; return nil }, seen: map[string]bool{}}
+	msgs := make(chan []byte, feedDedupSize+2)
+	for i := 0; i <= feedDedupSize; i++ {
+		msg, _ := json.Marshal(&FeedEvent{Build: &Build{ProjectId: 1, Number: i, Status: StatusSuccess}})
+		msgs <- msg
+	}
+	// the first build was forgotten to make room
+	first, _ := json.Marshal(&FeedEvent{Build: &Build{ProjectId: 1, Number: 0, Status: StatusSuccess}})
+	msgs <- first
+	close(msgs)
+	f.consume(msgs, nil)
+	if calls != feedDedupSize+2 || len(f.seen) != feedDedupSize {
+		t.Errorf("%d calls, %d remembered", calls, len(f.seen))
+	}
+}
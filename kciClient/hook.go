@@ -0,0 +1,191 @@
+package kciClient
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestInfo describes one api request. The same value is passed to
+// BeforeRequest and AfterRequest, so hooks may use its address as a key.
+type RequestInfo struct {
+	Method   string
+	Path     string // path template, e.g. /{version}/build/{proj}/{num}
+	URL      string
+	Status   int // 0 if no response was received
+	Duration time.Duration
+	BytesOut int64 // request body size, -1 if unknown
+	BytesIn  int64 // response body bytes read
+	Err      error
+}
+
+// WsEventType is the kind of a websocket event.
+type WsEventType int
+
+const (
+	WsConnect WsEventType = iota
+	WsMessage
+	WsDisconnect
+)
+
+// WsEvent describes something that happened on a FeedWs or LogWs connection.
+type WsEvent struct {
+	Type     WsEventType
+	ID       uint64 // identifies the connection
+	Path     string // path template, e.g. /ws/feed/{user}
+	URL      string
+	Bytes    int           // message size, for WsMessage
+	Duration time.Duration // connection lifetime, for WsDisconnect
+	Err      error         // dial error, for WsConnect
+}
+
+// Hook observes every request made by a client. Set it on ClientConfig.Hook.
+// Methods are called synchronously and must be safe for concurrent use.
+type Hook interface {
+	BeforeRequest(info *RequestInfo)
+	AfterRequest(info *RequestInfo) // called once the response body is closed
+	WsEvent(ev *WsEvent)
+}
+
+// Hooks calls several hooks in order.
+type Hooks []Hook
+
+func (hs Hooks) BeforeRequest(info *RequestInfo) {
+	for _, h := range hs {
+		h.BeforeRequest(info)
+	}
+}
+
+func (hs Hooks) AfterRequest(info *RequestInfo) {
+	for _, h := range hs {
+		h.AfterRequest(info)
+	}
+}
+
+func (hs Hooks) WsEvent(ev *WsEvent) {
+	for _, h := range hs {
+		h.WsEvent(ev)
+	}
+}
+
+// HookFuncs is a Hook built from optional functions.
+type HookFuncs struct {
+	Before func(info *RequestInfo)
+	After  func(info *RequestInfo)
+	Ws     func(ev *WsEvent)
+}
+
+func (h *HookFuncs) BeforeRequest(info *RequestInfo) {
+	if h.Before != nil {
+		h.Before(info)
+	}
+}
+
+func (h *HookFuncs) AfterRequest(info *RequestInfo) {
+	if h.After != nil {
+		h.After(info)
+	}
+}
+
+func (h *HookFuncs) WsEvent(ev *WsEvent) {
+	if h.Ws != nil {
+		h.Ws(ev)
+	}
+}
+
+// ---------------------------------------------------------------------------------------
+
+// path templates reported to hooks, matched in order. method is only set
+// where the path alone is ambiguous.
+var pathTemplates = []struct {
+	method, template string
+}{
+	{"", "/{version}/user"},
+	{"", "/{version}/user/{repoType}/repo"},
+	{"", "/{version}/project"},
+	{"", "/{version}/project/{proj}"},
+	{"", "/{version}/info/checkname/{name}"},
+	{"", "/{version}/build/{proj}"},
+	{"", "/{version}/build/{proj}/{num}/{job}/log"},
+	{"", "/{version}/build/{proj}/{num}/artifact"},
+	{"", "/{version}/build/{proj}/{num}/artifact/{name}"},
+	{"POST", "/{version}/build/{proj}/{branch}"},
+	{"", "/{version}/build/{proj}/{num}"},
+	{"", "/{version}/{repoType}/auth"},
+	{"", "/capabilities"},
+	{"", "/ws/feed/{user}"},
+	{"", "/ws/log/{proj}/{num}/{job}"},
+}
+
+var (
+	placeholderRe   = regexp.MustCompile(`\\\{(\w+)\\\}`)
+	templateOnce    sync.Once
+	templateMatches []*regexp.Regexp
+)
+
+func compileTemplates() {
+	for _, t := range pathTemplates {
+		re := placeholderRe.ReplaceAllStringFunc(regexp.QuoteMeta(t.template), func(m string) string {
+			if strings.Contains(m, "branch") {
+				return ".+"
+			}
+			return "[^/]+"
+		})
+		templateMatches = append(templateMatches, regexp.MustCompile("^"+re+"$"))
+	}
+}
+
+// pathTemplate returns the template of an api url, or its path if unknown.
+// prefix is the path of the base url and is not part of the template.
+func pathTemplate(prefix, method, rawurl string) string {
+	templateOnce.Do(compileTemplates)
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	// escaped, so that a %2F in an artifact name stays in its segment
+	path := strings.TrimPrefix(u.EscapedPath(), prefix)
+	for i, t := range pathTemplates {
+		if t.method != "" && t.method != method {
+			continue
+		}
+		if templateMatches[i].MatchString(path) {
+			return t.template
+		}
+	}
+	return path
+}
+
+// hookedBody reports the request to the hook once the body is closed.
+type hookedBody struct {
+	io.ReadCloser
+	hook  Hook
+	info  *RequestInfo
+	start time.Time
+	once  sync.Once
+}
+
+func (b *hookedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.info.BytesIn += int64(n)
+	return n, err
+}
+
+func (b *hookedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.info.Duration = time.Since(b.start)
+		b.hook.AfterRequest(b.info)
+	})
+	return err
+}
+
+var wsConnID uint64
+
+func nextWsConnID() uint64 {
+	return atomic.AddUint64(&wsConnID, 1)
+}
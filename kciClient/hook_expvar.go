@@ -0,0 +1,83 @@
+package kciClient
+
+import (
+	"expvar"
+	"strconv"
+)
+
+type expvarHook struct {
+	requests, errors, status, latency *expvar.Map
+	bytesIn, bytesOut                 *expvar.Int
+	wsConnects, wsDisconnects, wsMsgs *expvar.Int
+}
+
+// NewExpvarHook returns a hook that publishes request counts, errors, status
+// codes, total latency (ms) per path template and websocket counters as the
+// expvar map name. Calling it twice with the same name reuses the map.
+func NewExpvarHook(name string) Hook {
+	m, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		m = expvar.NewMap(name)
+	}
+	h := &expvarHook{
+		requests:      subMap(m, "requests"),
+		errors:        subMap(m, "errors"),
+		status:        subMap(m, "status"),
+		latency:       subMap(m, "latency_ms"),
+		bytesIn:       subInt(m, "bytes_in"),
+		bytesOut:      subInt(m, "bytes_out"),
+		wsConnects:    subInt(m, "ws_connects"),
+		wsDisconnects: subInt(m, "ws_disconnects"),
+		wsMsgs:        subInt(m, "ws_messages"),
+	}
+	return h
+}
+
+func subMap(m *expvar.Map, key string) *expvar.Map {
+	if v, ok := m.Get(key).(*expvar.Map); ok {
+		return v
+	}
+	v := new(expvar.Map).Init()
+	m.Set(key, v)
+	return v
+}
+
+func subInt(m *expvar.Map, key string) *expvar.Int {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	m.Set(key, v)
+	return v
+}
+
+func (h *expvarHook) BeforeRequest(info *RequestInfo) {}
+
+func (h *expvarHook) AfterRequest(info *RequestInfo) {
+	key := info.Method + " " + info.Path
+	h.requests.Add(key, 1)
+	if info.Err != nil {
+		h.errors.Add(key, 1)
+	}
+	if info.Status != 0 {
+		h.status.Add(strconv.Itoa(info.Status), 1)
+	}
+	h.latency.AddFloat(key, float64(info.Duration)/1e6)
+	h.bytesIn.Add(info.BytesIn)
+	if info.BytesOut > 0 {
+		h.bytesOut.Add(info.BytesOut)
+	}
+}
+
+func (h *expvarHook) WsEvent(ev *WsEvent) {
+	switch ev.Type {
+	case WsConnect:
+		if ev.Err == nil {
+			h.wsConnects.Add(1)
+		}
+	case WsDisconnect:
+		h.wsDisconnects.Add(1)
+	case WsMessage:
+		h.wsMsgs.Add(1)
+	}
+}
@@ -0,0 +1,222 @@
+package kciClient
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		prefix, method, url, want string
+	}{
+		{"", "GET", "https://h/v1/user", "/{version}/user"},
+		{"", "GET", "https://h/v1/build/12/34", "/{version}/build/{proj}/{num}"},
+		{"", "POST", "https://h/v1/build/12/feature/x", "/{version}/build/{proj}/{branch}"},
+		{"", "POST", "https://h/v1/build/12/34", "/{version}/build/{proj}/{branch}"},
+		{"", "GET", "https://h/v1/build/12/34/1/log", "/{version}/build/{proj}/{num}/{job}/log"},
+		{"", "GET", "https://h/v1/build/1/2/artifact/a%2Fb?job=3", "/{version}/build/{proj}/{num}/artifact/{name}"},
+		{"/kci", "GET", "https://h/kci/v1/project/5", "/{version}/project/{proj}"},
+		{"/kci", "GET", "https://h/kci/capabilities", "/capabilities"},
+		{"", "GET", "wss://h/ws/log/1/2/3", "/ws/log/{proj}/{num}/{job}"},
+		{"", "GET", "https://h/other/path", "/other/path"},
+	}
+	for _, tt := range tests {
+		if got := pathTemplate(tt.prefix, tt.method, tt.url); got != tt.want {
+			t.Errorf("pathTemplate(%q, %s %s) = %s, want %s", tt.prefix, tt.method, tt.url, got, tt.want)
+		}
+	}
+}
+
+// fakeWs is a WsTransport whose connections yield msgs and then end.
+type fakeWs struct {
+	msgs [][]byte
+	err  error
+
+	mu    sync.Mutex
+	dials []string
+}
+
+func (f *fakeWs) Dial(uri string, header http.Header) (<-chan []byte, error) {
+	f.mu.Lock()
+	f.dials = append(f.dials, uri)
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	ch := make(chan []byte, len(f.msgs))
+	for _, m := range f.msgs {
+		ch <- m
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestHook(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		before []string
+		after  []*RequestInfo
+		events []*WsEvent
+	)
+	hook := &HookFuncs{
+		Before: func(info *RequestInfo) {
+			mu.Lock()
+			before = append(before, info.Method+" "+info.Path)
+			mu.Unlock()
+		},
+		After: func(info *RequestInfo) {
+			mu.Lock()
+			after = append(after, info)
+			mu.Unlock()
+		},
+		Ws: func(ev *WsEvent) {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		},
+	}
+	c, ts := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/404") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"id":5,"projName":"p"}`)
+	}))
+	cfg := c.(*client).config
+	cfg.Hook = hook
+	cfg.WsTransport = &fakeWs{msgs: [][]byte{[]byte("a"), []byte("bc")}}
+	c = NewClientWithConfig(cfg)
+
+	if _, err := c.Proj(5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ProjPatch(404, &PatchProj{}); err == nil {
+		t.Error("patch: no error")
+	}
+	if len(before) != 2 || before[0] != "GET /{version}/project/{proj}" || before[1] != "POST /{version}/project/{proj}" {
+		t.Errorf("before %q", before)
+	}
+	if len(after) != 2 {
+		t.Fatalf("got %d AfterRequest calls", len(after))
+	}
+	if a := after[0]; a.Status != 200 || a.BytesIn != 23 || a.Err != nil || a.URL != ts.URL+"/v1/project/5" {
+		t.Errorf("first request %+v", a)
+	}
+	if a := after[1]; a.Status != 404 || a.Err == nil || a.BytesOut <= 0 {
+		t.Errorf("second request %+v", a)
+	}
+
+	msgs, err := c.LogWs(1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range msgs {
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var types []WsEventType
+	for _, ev := range events {
+		types = append(types, ev.Type)
+		if ev.ID != events[0].ID || ev.Path != "/ws/log/{proj}/{num}/{job}" {
+			t.Errorf("event %+v", ev)
+		}
+	}
+	if fmt.Sprint(types) != fmt.Sprint([]WsEventType{WsConnect, WsMessage, WsMessage, WsDisconnect}) {
+		t.Errorf("events %v", types)
+	}
+	if events[2].Bytes != 2 {
+		t.Errorf("message size %d", events[2].Bytes)
+	}
+}
+
+func TestExpvarHook(t *testing.T) {
+	h := NewExpvarHook("kci_test")
+	if NewExpvarHook("kci_test") == nil {
+		t.Fatal("second hook with the same name")
+	}
+	h.AfterRequest(&RequestInfo{Method: "GET", Path: "/p", Status: 200, BytesIn: 10, BytesOut: -1})
+	h.AfterRequest(&RequestInfo{Method: "GET", Path: "/p", Status: 500, Err: errors.New("x"), BytesOut: 3})
+	h.WsEvent(&WsEvent{Type: WsConnect})
+	h.WsEvent(&WsEvent{Type: WsConnect, Err: errors.New("refused")})
+	h.WsEvent(&WsEvent{Type: WsMessage})
+
+	m := expvar.Get("kci_test").(*expvar.Map)
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"requests", "GET /p"}, "2"},
+		{[]string{"errors", "GET /p"}, "1"},
+		{[]string{"status", "500"}, "1"},
+		{[]string{"bytes_in"}, "10"},
+		{[]string{"bytes_out"}, "3"},
+		{[]string{"ws_connects"}, "1"},
+		{[]string{"ws_messages"}, "1"},
+	}
+	for _, tt := range tests {
+		v := m.Get(tt.path[0])
+		if len(tt.path) > 1 {
+			v = v.(*expvar.Map).Get(tt.path[1])
+		}
+		if v == nil || v.String() != tt.want {
+			t.Errorf("%v = %v, want %s", tt.path, v, tt.want)
+		}
+	}
+}
+
+type fakeSpan struct {
+	name   string
+	attrs  map[string]interface{}
+	events []string
+	err    error
+	ended  bool
+}
+
+func (s *fakeSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *fakeSpan) AddEvent(name string)                       { s.events = append(s.events, name) }
+func (s *fakeSpan) RecordError(err error)                      { s.err = err }
+func (s *fakeSpan) End()                                       { s.ended = true }
+
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) Start(name string) Span {
+	s := &fakeSpan{name: name, attrs: map[string]interface{}{}}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func TestTraceHook(t *testing.T) {
+	tr := new(fakeTracer)
+	h := NewTraceHook(tr)
+	info := &RequestInfo{Method: "GET", Path: "/{version}/user", Status: 503, Err: errors.New("busy"), BytesOut: -1}
+	h.BeforeRequest(info)
+	h.AfterRequest(info)
+	h.WsEvent(&WsEvent{Type: WsConnect, ID: 1, Path: "/ws/feed/{user}"})
+	h.WsEvent(&WsEvent{Type: WsMessage, ID: 1})
+	h.WsEvent(&WsEvent{Type: WsDisconnect, ID: 1})
+	h.WsEvent(&WsEvent{Type: WsConnect, ID: 2, Err: errors.New("refused")})
+
+	if len(tr.spans) != 3 {
+		t.Fatalf("got %d spans", len(tr.spans))
+	}
+	req, ws, failed := tr.spans[0], tr.spans[1], tr.spans[2]
+	if req.name != "GET /{version}/user" || !req.ended || req.err == nil || req.attrs["http.status_code"] != 503 {
+		t.Errorf("request span %+v", req)
+	}
+	if _, ok := req.attrs["http.request_content_length"]; ok {
+		t.Error("unknown request length recorded")
+	}
+	if ws.name != "WS /ws/feed/{user}" || !ws.ended || len(ws.events) != 1 {
+		t.Errorf("ws span %+v", ws)
+	}
+	if !failed.ended || failed.err == nil {
+		t.Errorf("failed dial span %+v", failed)
+	}
+}
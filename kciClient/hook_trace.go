@@ -0,0 +1,97 @@
+package kciClient
+
+import (
+	"sync"
+)
+
+// Span is the subset of an OpenTelemetry span used by the trace hook.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	AddEvent(name string)
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans, e.g. a thin wrapper around an OpenTelemetry tracer.
+type Tracer interface {
+	Start(name string) Span
+}
+
+type traceHook struct {
+	tracer Tracer
+
+	mu    sync.Mutex
+	spans map[*RequestInfo]Span
+	conns map[uint64]Span
+}
+
+// NewTraceHook returns a hook that records a span per request, named like
+// "GET /{version}/build/{proj}/{num}", and a span per websocket connection with an
+// event per message.
+func NewTraceHook(t Tracer) Hook {
+	return &traceHook{
+		tracer: t,
+		spans:  map[*RequestInfo]Span{},
+		conns:  map[uint64]Span{},
+	}
+}
+
+func (h *traceHook) BeforeRequest(info *RequestInfo) {
+	span := h.tracer.Start(info.Method + " " + info.Path)
+	span.SetAttribute("http.method", info.Method)
+	span.SetAttribute("http.route", info.Path)
+	span.SetAttribute("http.url", info.URL)
+	h.mu.Lock()
+	h.spans[info] = span
+	h.mu.Unlock()
+}
+
+func (h *traceHook) AfterRequest(info *RequestInfo) {
+	h.mu.Lock()
+	span, ok := h.spans[info]
+	delete(h.spans, info)
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	if info.Status != 0 {
+		span.SetAttribute("http.status_code", info.Status)
+	}
+	span.SetAttribute("http.response_content_length", info.BytesIn)
+	if info.BytesOut >= 0 {
+		span.SetAttribute("http.request_content_length", info.BytesOut)
+	}
+	if info.Err != nil {
+		span.RecordError(info.Err)
+	}
+	span.End()
+}
+
+func (h *traceHook) WsEvent(ev *WsEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch ev.Type {
+	case WsConnect:
+		span := h.tracer.Start("WS " + ev.Path)
+		span.SetAttribute("http.route", ev.Path)
+		span.SetAttribute("http.url", ev.URL)
+		if ev.Err != nil {
+			span.RecordError(ev.Err)
+			span.End()
+			return
+		}
+		h.conns[ev.ID] = span
+	case WsMessage:
+		if span, ok := h.conns[ev.ID]; ok {
+			span.AddEvent("message")
+		}
+	case WsDisconnect:
+		if span, ok := h.conns[ev.ID]; ok {
+			if ev.Err != nil {
+				span.RecordError(ev.Err)
+			}
+			span.End()
+			delete(h.conns, ev.ID)
+		}
+	}
+}
@@ -1,5 +1,9 @@
 package kciClient
 
+import (
+	"io"
+)
+
 // Client describes a kci client.
 type Client interface {
 	// 返回用户信息（绑定的子帐户信息）
@@ -38,6 +42,15 @@ type Client interface {
 	// 解除绑定
 	AuthDel(repoType string) error
 
+	// 获取构建产物列表
+	ArtifactList(projId int64, buildNum int) ([]*Artifact, error)
+
+	// 下载构建产物, offset > 0 时断点续传, 返回本次写入的字节数
+	ArtifactDownload(projId int64, buildNum int, name string, w io.Writer, offset int64) (int64, error)
+
+	// 上传构建产物
+	ArtifactUpload(projId int64, buildNum, jobNum int, name string, r io.Reader) (*Artifact, error)
+
 	// 检查项目名是否可用
 	CheckProjName(name string) (*CheckProjNameRes, error)
 
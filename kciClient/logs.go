@@ -0,0 +1,64 @@
+package kciClient
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// LogStreamer is implemented by clients that decode a job log entry by entry
+// instead of loading it whole. The client of NewClient implements it.
+type LogStreamer interface {
+	EachBuildLog(projId int64, buildNum, jobNum int, fn func(l *Log) error) error
+}
+
+// EachBuildLog calls fn for every entry of the log of a job, stopping at the
+// first error. Clients that are not LogStreamers load the log with
+// BuildLogs first.
+func EachBuildLog(c Client, projId int64, buildNum, jobNum int, fn func(l *Log) error) error {
+	if s, ok := c.(LogStreamer); ok {
+		return s.EachBuildLog(projId, buildNum, jobNum, fn)
+	}
+	logs, err := c.BuildLogs(projId, buildNum, jobNum)
+	if err != nil {
+		return err
+	}
+	for _, l := range logs {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 逐条获取某次构建的日志
+func (c *client) EachBuildLog(projId int64, buildNum, jobNum int, fn func(l *Log) error) error {
+	uri := fmt.Sprintf(pathBuildLogById, c.api(), projId, buildNum, jobNum)
+	resp, err := c.stream(uri, "GET", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil // null, no log yet
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("kci: log of job %d is not an array", jobNum)
+	}
+	for dec.More() {
+		l := new(Log)
+		if err := dec.Decode(l); err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
@@ -0,0 +1,67 @@
+package kciClient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestEachBuildLog(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		body    string
+		stopAt  int
+		want    int
+		wantErr bool
+	}{
+		{"entries", `[{"proc":"a","out":"1"},{"proc":"a","out":"2"}]`, -1, 2, false},
+		{"null", `null`, -1, 0, false},
+		{"empty", `[]`, -1, 0, false},
+		{"stop", `[{"out":"1"},{"out":"2"},{"out":"3"}]`, 1, 2, true},
+		{"not array", `{"out":"1"}`, -1, 0, true},
+		{"truncated", `[{"out":"1"},{"ou`, -1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.body)
+			}))
+			var n int
+			err := EachBuildLog(c, 1, 2, 3, func(l *Log) error {
+				n++
+				if n-1 == tt.stopAt {
+					return errStop
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr || n != tt.want {
+				t.Errorf("got %d entries, err %v", n, err)
+			}
+		})
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	key := func(cfg ClientConfig) string { return AccountKey(NewClientWithConfig(&cfg)) }
+	a := key(ClientConfig{Host: "a.com", AK: "ak"})
+	tests := []struct {
+		name string
+		cfg  ClientConfig
+		same bool
+	}{
+		{"same", ClientConfig{Host: "a.com", AK: "ak", SK: "other"}, true},
+		{"other ak", ClientConfig{Host: "a.com", AK: "ak2"}, false},
+		{"other host", ClientConfig{Host: "b.com", AK: "ak"}, false},
+		{"other prefix", ClientConfig{BaseURL: "https://a.com/kci", AK: "ak"}, false},
+	}
+	for _, tt := range tests {
+		if got := key(tt.cfg); (got == a) != tt.same {
+			t.Errorf("%s: key %s, first %s", tt.name, got, a)
+		}
+	}
+	if a == "" || AccountKey(NewMockClient()) != "" {
+		t.Error("want a key for clients only")
+	}
+}
@@ -1,12 +1,15 @@
 package kciClient
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
+	"errors"
 	"io"
 	"net/http"
 	"sort"
+	"strings"
 
 	"qiniupkg.com/x/bytes.v7/seekable"
 )
@@ -28,6 +31,76 @@ func (m *Mac) SignRequest(req *http.Request) (err error) {
 	return
 }
 
+// SignRequestBody signs req like SignRequest, except that the body is
+// signed whatever its content type. Webhook deliveries are signed this way.
+func (m *Mac) SignRequestBody(req *http.Request) error {
+
+	data, err := canonical(req, req.Host, true)
+	if err != nil {
+		return err
+	}
+	auth := "Qiniu " + m.AccessKey + ":" + base64.URLEncoding.EncodeToString(m.sum(data))
+	req.Header.Set("Authorization", auth)
+	return nil
+}
+
+// ErrBadSignature is returned by VerifyRequest for a missing or wrong
+// Authorization header.
+var ErrBadSignature = errors.New("kci: bad request signature")
+
+// VerifyRequest checks that req was signed by SignRequest with the same keys.
+// The body is read and replaced, so it can still be read afterwards.
+func (m *Mac) VerifyRequest(req *http.Request) error {
+
+	data, err := canonicalRequest(req)
+	if err != nil {
+		return err
+	}
+	return m.verify(req, data)
+}
+
+// VerifyRequestBody checks that req was signed by SignRequestBody with the
+// same keys. host, if not empty, is checked in place of req.Host, for
+// servers behind a proxy that rewrites it. The body is read and replaced.
+func (m *Mac) VerifyRequestBody(req *http.Request, host string) error {
+
+	if host == "" {
+		host = req.Host
+	}
+	data, err := canonical(req, host, true)
+	if err != nil {
+		return err
+	}
+	return m.verify(req, data)
+}
+
+func (m *Mac) verify(req *http.Request, data []byte) error {
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Qiniu ") {
+		return ErrBadSignature
+	}
+	parts := strings.SplitN(auth[len("Qiniu "):], ":", 2)
+	if len(parts) != 2 || parts[0] != m.AccessKey {
+		return ErrBadSignature
+	}
+	got, err := base64.URLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrBadSignature
+	}
+	if !hmac.Equal(got, m.sum(data)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func (m *Mac) sum(data []byte) []byte {
+
+	h := hmac.New(sha1.New, m.SecretKey)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
 type Transport struct {
 	mac       Mac
 	Transport http.RoundTripper
@@ -99,14 +172,35 @@ func signQiniuHeaderValues(header http.Header, w io.Writer) {
 
 func signRequest(sk []byte, req *http.Request) ([]byte, error) {
 
+	data, err := canonicalRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
 	h := hmac.New(sha1.New, sk)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// canonicalRequest returns the bytes signRequest hashes.
+func canonicalRequest(req *http.Request) ([]byte, error) {
+
+	return canonical(req, req.Host, false)
+}
+
+// canonical returns the bytes signed for req, as sent to host. The body is
+// included if allBody is set or its content type is neither empty nor
+// application/octet-stream.
+func canonical(req *http.Request, host string, allBody bool) ([]byte, error) {
+
+	h := new(bytes.Buffer)
 
 	u := req.URL
 	data := req.Method + " " + u.Path
 	if u.RawQuery != "" {
 		data += "?" + u.RawQuery
 	}
-	io.WriteString(h, data+"\nHost: "+req.Host)
+	io.WriteString(h, data+"\nHost: "+host)
 
 	ctType := req.Header.Get("Content-Type")
 	if ctType != "" {
@@ -117,7 +211,7 @@ func signRequest(sk []byte, req *http.Request) ([]byte, error) {
 
 	io.WriteString(h, "\n\n")
 
-	if incBody(req, ctType) {
+	if incBody(req, ctType) || allBody && req.ContentLength != 0 && req.Body != nil && req.Body != http.NoBody {
 		s2, err2 := seekable.New(req)
 		if err2 != nil {
 			return nil, err2
@@ -125,7 +219,7 @@ func signRequest(sk []byte, req *http.Request) ([]byte, error) {
 		h.Write(s2.Bytes())
 	}
 
-	return h.Sum(nil), nil
+	return h.Bytes(), nil
 }
 
 // ---------------------------------------------------------------------------------------
@@ -0,0 +1,350 @@
+package kciClient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// ErrNotMocked is returned by MockClient methods that have no response set.
+var ErrNotMocked = errors.New("kciClient: method not mocked")
+
+// keep MockClient in sync with the interfaces
+var (
+	_ Client             = (*MockClient)(nil)
+	_ CapabilitiesClient = (*MockClient)(nil)
+)
+
+// Call is a recorded call to a MockClient method.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// TestingT is the part of *testing.T used by the assertions.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// MockClient is a Client for unit tests. Set the Func field of a method to
+// program its response; methods without one return ErrNotMocked. Every call
+// is recorded. FeedWs and LogWs, unless programmed, return channels fed by
+// PushFeed and PushLog, and Capabilities reports the default version only,
+// as an old server does.
+type MockClient struct {
+	SelfFunc             func() ([]*User, error)
+	RepoListFunc         func(repoType string) ([]*Repo, error)
+	ProjPostFunc         func(req *CreateProjReq) (*Project, error)
+	ProjListFunc         func() ([]*Project, error)
+	ProjFunc             func(projId int64) (*Project, error)
+	ProjPatchFunc        func(projId int64, p *PatchProj) (*Project, error)
+	ProjDelFunc          func(projId int64) error
+	BuildPostFunc        func(projId int64, branch string) (*Build, error)
+	BuildListFunc        func(projId int64) ([]*Build, error)
+	BuildByIdFunc        func(projId int64, buildNum int) (*Build, error)
+	BuildLogsFunc        func(projId int64, buildNum, jobNum int) ([]*Log, error)
+	AuthDelFunc          func(repoType string) error
+	CheckProjNameFunc    func(name string) (*CheckProjNameRes, error)
+	ArtifactListFunc     func(projId int64, buildNum int) ([]*Artifact, error)
+	ArtifactDownloadFunc func(projId int64, buildNum int, name string, w io.Writer, offset int64) (int64, error)
+	ArtifactUploadFunc   func(projId int64, buildNum, jobNum int, name string, r io.Reader) (*Artifact, error)
+	CapabilitiesFunc     func() (*Capabilities, error)
+	FeedWsFunc           func(userid uint64) (<-chan []byte, error)
+	LogWsFunc            func(projId int64, buildNum, jobNum int) (<-chan []byte, error)
+
+	mu    sync.Mutex
+	calls []*Call
+	feeds map[uint64]chan []byte
+	logs  map[[3]int64]chan []byte
+}
+
+// NewMockClient returns a MockClient with no responses programmed.
+func NewMockClient() *MockClient {
+	return new(MockClient)
+}
+
+func (m *MockClient) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	m.calls = append(m.calls, &Call{Method: method, Args: args})
+	m.mu.Unlock()
+}
+
+// Calls returns all recorded calls in order.
+func (m *MockClient) Calls() []*Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Call(nil), m.calls...)
+}
+
+// CallsTo returns the recorded calls to method.
+func (m *MockClient) CallsTo(method string) []*Call {
+	var out []*Call
+	for _, c := range m.Calls() {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Reset forgets the recorded calls.
+func (m *MockClient) Reset() {
+	m.mu.Lock()
+	m.calls = nil
+	m.mu.Unlock()
+}
+
+// AssertCalled fails t unless method was called with args. Arguments are
+// compared with reflect.DeepEqual, so their types must match the method's
+// parameters, e.g. int64(1) for a project id.
+func (m *MockClient) AssertCalled(t TestingT, method string, args ...interface{}) bool {
+	calls := m.CallsTo(method)
+	for _, c := range calls {
+		if reflect.DeepEqual(c.Args, args) {
+			return true
+		}
+	}
+	if len(calls) == 0 {
+		t.Errorf("expected call to %s%v, got none", method, args)
+	} else {
+		t.Errorf("expected call to %s%v, got %s", method, args, formatCalls(calls))
+	}
+	return false
+}
+
+// AssertNotCalled fails t if method was called.
+func (m *MockClient) AssertNotCalled(t TestingT, method string) bool {
+	if calls := m.CallsTo(method); len(calls) > 0 {
+		t.Errorf("expected no call to %s, got %s", method, formatCalls(calls))
+		return false
+	}
+	return true
+}
+
+// AssertNumberOfCalls fails t unless method was called n times.
+func (m *MockClient) AssertNumberOfCalls(t TestingT, method string, n int) bool {
+	if got := len(m.CallsTo(method)); got != n {
+		t.Errorf("expected %d calls to %s, got %d", n, method, got)
+		return false
+	}
+	return true
+}
+
+func formatCalls(calls []*Call) string {
+	s := ""
+	for i, c := range calls {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s%v", c.Method, c.Args)
+	}
+	return s
+}
+
+// ---------------------------------------------------------------------------------------
+
+func (m *MockClient) feed(userid uint64) chan []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.feeds == nil {
+		m.feeds = map[uint64]chan []byte{}
+	}
+	ch, ok := m.feeds[userid]
+	if !ok {
+		ch = make(chan []byte, 64)
+		m.feeds[userid] = ch
+	}
+	return ch
+}
+
+func (m *MockClient) log(projId int64, buildNum, jobNum int) chan []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.logs == nil {
+		m.logs = map[[3]int64]chan []byte{}
+	}
+	key := [3]int64{projId, int64(buildNum), int64(jobNum)}
+	ch, ok := m.logs[key]
+	if !ok {
+		ch = make(chan []byte, 64)
+		m.logs[key] = ch
+	}
+	return ch
+}
+
+// PushFeed sends a message to the FeedWs channel of userid. Messages pushed
+// before FeedWs is called are buffered.
+func (m *MockClient) PushFeed(userid uint64, msg []byte) {
+	m.feed(userid) <- msg
+}
+
+// CloseFeed closes the FeedWs channel of userid, as a dropped connection would.
+func (m *MockClient) CloseFeed(userid uint64) {
+	close(m.feed(userid))
+}
+
+// PushLog sends a message to the LogWs channel of a job.
+func (m *MockClient) PushLog(projId int64, buildNum, jobNum int, msg []byte) {
+	m.log(projId, buildNum, jobNum) <- msg
+}
+
+// CloseLog closes the LogWs channel of a job.
+func (m *MockClient) CloseLog(projId int64, buildNum, jobNum int) {
+	close(m.log(projId, buildNum, jobNum))
+}
+
+// ---------------------------------------------------------------------------------------
+
+func (m *MockClient) Self() ([]*User, error) {
+	m.record("Self")
+	if m.SelfFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SelfFunc()
+}
+
+func (m *MockClient) RepoList(repoType string) ([]*Repo, error) {
+	m.record("RepoList", repoType)
+	if m.RepoListFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.RepoListFunc(repoType)
+}
+
+func (m *MockClient) ProjPost(req *CreateProjReq) (*Project, error) {
+	m.record("ProjPost", req)
+	if m.ProjPostFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ProjPostFunc(req)
+}
+
+func (m *MockClient) ProjList() ([]*Project, error) {
+	m.record("ProjList")
+	if m.ProjListFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ProjListFunc()
+}
+
+func (m *MockClient) Proj(projId int64) (*Project, error) {
+	m.record("Proj", projId)
+	if m.ProjFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ProjFunc(projId)
+}
+
+func (m *MockClient) ProjPatch(projId int64, p *PatchProj) (*Project, error) {
+	m.record("ProjPatch", projId, p)
+	if m.ProjPatchFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ProjPatchFunc(projId, p)
+}
+
+func (m *MockClient) ProjDel(projId int64) error {
+	m.record("ProjDel", projId)
+	if m.ProjDelFunc == nil {
+		return ErrNotMocked
+	}
+	return m.ProjDelFunc(projId)
+}
+
+func (m *MockClient) BuildPost(projId int64, branch string) (*Build, error) {
+	m.record("BuildPost", projId, branch)
+	if m.BuildPostFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.BuildPostFunc(projId, branch)
+}
+
+func (m *MockClient) BuildList(projId int64) ([]*Build, error) {
+	m.record("BuildList", projId)
+	if m.BuildListFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.BuildListFunc(projId)
+}
+
+func (m *MockClient) BuildById(projId int64, buildNum int) (*Build, error) {
+	m.record("BuildById", projId, buildNum)
+	if m.BuildByIdFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.BuildByIdFunc(projId, buildNum)
+}
+
+func (m *MockClient) BuildLogs(projId int64, buildNum, jobNum int) ([]*Log, error) {
+	m.record("BuildLogs", projId, buildNum, jobNum)
+	if m.BuildLogsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.BuildLogsFunc(projId, buildNum, jobNum)
+}
+
+func (m *MockClient) AuthDel(repoType string) error {
+	m.record("AuthDel", repoType)
+	if m.AuthDelFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AuthDelFunc(repoType)
+}
+
+func (m *MockClient) CheckProjName(name string) (*CheckProjNameRes, error) {
+	m.record("CheckProjName", name)
+	if m.CheckProjNameFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.CheckProjNameFunc(name)
+}
+
+func (m *MockClient) Capabilities() (*Capabilities, error) {
+	m.record("Capabilities")
+	if m.CapabilitiesFunc == nil {
+		return &Capabilities{Versions: []string{defaultAPIVersion}}, nil
+	}
+	return m.CapabilitiesFunc()
+}
+
+func (m *MockClient) ArtifactList(projId int64, buildNum int) ([]*Artifact, error) {
+	m.record("ArtifactList", projId, buildNum)
+	if m.ArtifactListFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ArtifactListFunc(projId, buildNum)
+}
+
+func (m *MockClient) ArtifactDownload(projId int64, buildNum int, name string, w io.Writer, offset int64) (int64, error) {
+	m.record("ArtifactDownload", projId, buildNum, name, w, offset)
+	if m.ArtifactDownloadFunc == nil {
+		return 0, ErrNotMocked
+	}
+	return m.ArtifactDownloadFunc(projId, buildNum, name, w, offset)
+}
+
+func (m *MockClient) ArtifactUpload(projId int64, buildNum, jobNum int, name string, r io.Reader) (*Artifact, error) {
+	m.record("ArtifactUpload", projId, buildNum, jobNum, name, r)
+	if m.ArtifactUploadFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ArtifactUploadFunc(projId, buildNum, jobNum, name, r)
+}
+
+func (m *MockClient) FeedWs(userid uint64) (<-chan []byte, error) {
+	m.record("FeedWs", userid)
+	if m.FeedWsFunc != nil {
+		return m.FeedWsFunc(userid)
+	}
+	return m.feed(userid), nil
+}
+
+func (m *MockClient) LogWs(projId int64, buildNum, jobNum int) (<-chan []byte, error) {
+	m.record("LogWs", projId, buildNum, jobNum)
+	if m.LogWsFunc != nil {
+		return m.LogWsFunc(projId, buildNum, jobNum)
+	}
+	return m.log(projId, buildNum, jobNum), nil
+}
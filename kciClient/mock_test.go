@@ -0,0 +1,98 @@
+package kciClient
+
+import (
+	"fmt"
+	"testing"
+)
+
+// recordingT is a TestingT that keeps the failures.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMockClient(t *testing.T) {
+	m := NewMockClient()
+	if _, err := m.Proj(1); err != ErrNotMocked {
+		t.Errorf("unprogrammed Proj: %v", err)
+	}
+	m.ProjFunc = func(projId int64) (*Project, error) {
+		return &Project{ID: projId, ProjName: "p"}, nil
+	}
+	if p, err := m.Proj(2); err != nil || p.ID != 2 {
+		t.Errorf("Proj(2) = %+v, %v", p, err)
+	}
+	m.BuildPost(2, "master")
+
+	tests := []struct {
+		name   string
+		assert func(tt TestingT) bool
+		ok     bool
+	}{
+		{"called", func(tt TestingT) bool { return m.AssertCalled(tt, "Proj", int64(2)) }, true},
+		{"called with int", func(tt TestingT) bool { return m.AssertCalled(tt, "Proj", 2) }, false},
+		{"never called", func(tt TestingT) bool { return m.AssertCalled(tt, "ProjDel", int64(2)) }, false},
+		{"not called", func(tt TestingT) bool { return m.AssertNotCalled(tt, "ProjDel") }, true},
+		{"not called fails", func(tt TestingT) bool { return m.AssertNotCalled(tt, "BuildPost") }, false},
+		{"number", func(tt TestingT) bool { return m.AssertNumberOfCalls(tt, "Proj", 2) }, true},
+		{"wrong number", func(tt TestingT) bool { return m.AssertNumberOfCalls(tt, "BuildPost", 2) }, false},
+	}
+	for _, tt := range tests {
+		rt := new(recordingT)
+		if ok := tt.assert(rt); ok != tt.ok || (len(rt.errors) == 0) != tt.ok {
+			t.Errorf("%s: got %v, errors %q", tt.name, ok, rt.errors)
+		}
+	}
+
+	if n := len(m.Calls()); n != 3 {
+		t.Errorf("recorded %d calls, want 3", n)
+	}
+	m.Reset()
+	if n := len(m.Calls()); n != 0 {
+		t.Errorf("recorded %d calls after Reset", n)
+	}
+}
+
+func TestMockWebsockets(t *testing.T) {
+	m := NewMockClient()
+	m.PushFeed(7, []byte("early"))
+	feed, err := m.FeedWs(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.PushFeed(7, []byte("late"))
+	m.CloseFeed(7)
+	var got []string
+	for msg := range feed {
+		got = append(got, string(msg))
+	}
+	if fmt.Sprint(got) != "[early late]" {
+		t.Errorf("feed %q", got)
+	}
+
+	logs, _ := m.LogWs(1, 2, 3)
+	other, _ := m.LogWs(1, 2, 4)
+	m.PushLog(1, 2, 3, []byte("line"))
+	m.CloseLog(1, 2, 3)
+	if msg := <-logs; string(msg) != "line" {
+		t.Errorf("log %q", msg)
+	}
+	if _, open := <-logs; open {
+		t.Error("log not closed")
+	}
+	select {
+	case msg := <-other:
+		t.Errorf("other job got %q", msg)
+	default:
+	}
+
+	m.LogWsFunc = func(projId int64, buildNum, jobNum int) (<-chan []byte, error) {
+		return nil, ErrNotMocked
+	}
+	if _, err := m.LogWs(1, 2, 3); err != ErrNotMocked {
+		t.Errorf("programmed LogWs: %v", err)
+	}
+}
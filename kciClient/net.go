@@ -0,0 +1,175 @@
+package kciClient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// baseURLs returns the http and websocket base urls of config, without a
+// trailing slash.
+func (config *ClientConfig) baseURLs() (*url.URL, *url.URL, error) {
+	raw := config.BaseURL
+	if raw == "" {
+		scheme := config.Scheme
+		if scheme == "" {
+			scheme = "https"
+		}
+		raw = scheme + "://" + config.Host
+	}
+	base, err := url.Parse(strings.TrimRight(raw, "/"))
+	if err != nil {
+		return &url.URL{}, &url.URL{}, err
+	}
+	ws := *base
+	switch base.Scheme {
+	case "https":
+		ws.Scheme = "wss"
+	case "http":
+		ws.Scheme = "ws"
+	default:
+		return base, &ws, fmt.Errorf("kci: unknown scheme %q", base.Scheme)
+	}
+	if base.Host == "" {
+		return base, &ws, fmt.Errorf("kci: no host in %q", raw)
+	}
+	return base, &ws, nil
+}
+
+// tlsConfig returns a clone of config.TLSConfig with CAFile, CertFile,
+// KeyFile and InsecureSkipVerify applied.
+func (config *ClientConfig) tlsConfig() (*tls.Config, error) {
+	tc := new(tls.Config)
+	if config.TLSConfig != nil {
+		tc = config.TLSConfig.Clone()
+	}
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kci: no certificates in %s", config.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		if config.CertFile == "" || config.KeyFile == "" {
+			return nil, errors.New("kci: CertFile and KeyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = append(tc.Certificates, cert)
+	}
+	if config.InsecureSkipVerify {
+		tc.InsecureSkipVerify = true
+	}
+	return tc, nil
+}
+
+// proxy returns the proxy func of config, the environment proxy if
+// config.Proxy is empty.
+func (config *ClientConfig) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if config.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(u), nil
+}
+
+func (config *ClientConfig) dialer() *net.Dialer {
+	timeout := config.DialTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+}
+
+func (config *ClientConfig) handshakeTimeout() time.Duration {
+	if config.HandshakeTimeout == 0 {
+		return 10 * time.Second
+	}
+	return config.HandshakeTimeout
+}
+
+// NewHTTPTransport returns the transport used when config.Transport is nil. It
+// applies the TLS, proxy and timeout settings of config.
+func (config *ClientConfig) NewHTTPTransport() (*http.Transport, error) {
+	tc, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := config.proxy()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Transport{
+		Proxy:               proxy,
+		DialContext:         config.dialer().DialContext,
+		TLSClientConfig:     tc,
+		TLSHandshakeTimeout: config.handshakeTimeout(),
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}, nil
+}
+
+// NewWsTransport returns the websocket transport used when
+// config.WsTransport is nil. It applies the same TLS, proxy and timeout
+// settings as NewHTTPTransport.
+func (config *ClientConfig) NewWsTransport() (WsTransport, error) {
+	tc, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := config.proxy()
+	if err != nil {
+		return nil, err
+	}
+	return &wsDialer{
+		dialer: &websocket.Dialer{
+			Proxy:            proxy,
+			NetDial:          config.dialer().Dial,
+			TLSClientConfig:  tc,
+			HandshakeTimeout: config.handshakeTimeout(),
+		},
+	}, nil
+}
+
+// transports returns the http and websocket transports of config, building
+// the ones not set.
+func (config *ClientConfig) transports() (http.RoundTripper, WsTransport, error) {
+	var (
+		transport   = config.Transport
+		wsTransport = config.WsTransport
+	)
+	if transport == nil {
+		t, err := config.NewHTTPTransport()
+		if err != nil {
+			return nil, nil, err
+		}
+		transport = t
+	}
+	if wsTransport == nil {
+		t, err := config.NewWsTransport()
+		if err != nil {
+			return nil, nil, err
+		}
+		wsTransport = t
+	}
+	return transport, wsTransport, nil
+}
@@ -0,0 +1,255 @@
+package kciClient
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// endpoint groups that can be limited separately
+const (
+	GroupLogs      = "logs"
+	GroupArtifacts = "artifacts"
+	GroupMetadata  = "metadata" // every other endpoint
+)
+
+// default pause after a 429 without Retry-After
+const defaultRetryAfter = time.Second
+
+// default number of retries of a request answered with 429
+const defaultMaxRetries = 3
+
+// RateLimit configures client side throttling. The top level limit applies
+// to all requests; a limit in Groups applies in addition to the requests of
+// that endpoint group. Websocket dials of FeedWs and LogWs count as requests.
+//
+// A request answered with 429 pauses its limiters for the Retry-After of the
+// response and is then sent again, up to MaxRetries times. Requests with a
+// body that cannot be rewound, e.g. artifact uploads of a plain io.Reader,
+// are not retried.
+type RateLimit struct {
+	Rate        float64 // requests per second, 0 for no limit
+	Burst       int     // requests allowed at once, defaults to 1
+	MaxInFlight int     // concurrent requests, 0 for no limit
+	MaxRetries  int     // retries after a 429, defaults to 3, -1 for none
+
+	Groups map[string]*RateLimit // keyed by GroupLogs, GroupArtifacts, GroupMetadata
+}
+
+// endpointGroup returns the group of a path template.
+func endpointGroup(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/log") || strings.HasPrefix(path, "/ws/log"):
+		return GroupLogs
+	case strings.Contains(path, "/artifact"):
+		return GroupArtifacts
+	}
+	return GroupMetadata
+}
+
+// rateLimiter holds the global limiter and one per group.
+type rateLimiter struct {
+	global  *limiter
+	groups  map[string]*limiter
+	retries int
+}
+
+func newRateLimiter(config *RateLimit) *rateLimiter {
+	if config == nil {
+		return nil
+	}
+	r := &rateLimiter{global: newLimiter(config), groups: map[string]*limiter{}, retries: config.MaxRetries}
+	if r.retries == 0 {
+		r.retries = defaultMaxRetries
+	}
+	for group, gc := range config.Groups {
+		if gc != nil {
+			r.groups[group] = newLimiter(gc)
+		}
+	}
+	return r
+}
+
+// acquire blocks until a request to path may be sent. The returned function
+// must be called once the request is done.
+func (r *rateLimiter) acquire(path string) (release func()) {
+	if r == nil {
+		return func() {}
+	}
+	group := r.groups[endpointGroup(path)]
+	releaseGlobal := r.global.acquire()
+	if group == nil {
+		return releaseGlobal
+	}
+	releaseGroup := group.acquire()
+	return func() {
+		releaseGroup()
+		releaseGlobal()
+	}
+}
+
+// retry returns the request to send again after a 429 on attempt n, the
+// first being 0, or false if it must not be retried.
+func (r *rateLimiter) retry(req *http.Request, resp *http.Response, n int) (*http.Request, bool) {
+	if r == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests || n >= r.retries {
+		return nil, false
+	}
+	next := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, false
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, false
+		}
+		next.Body = body
+	}
+	return next, true
+}
+
+// observe adapts the limits to a response: a 429 slows down, anything else
+// lets the rate recover.
+func (r *rateLimiter) observe(path string, resp *http.Response) {
+	if r == nil {
+		return
+	}
+	group := r.groups[endpointGroup(path)]
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := retryAfter(resp.Header.Get("Retry-After"))
+		r.global.throttle(wait)
+		if group != nil {
+			group.throttle(wait)
+		}
+		return
+	}
+	r.global.recover()
+	if group != nil {
+		group.recover()
+	}
+}
+
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return defaultRetryAfter
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(time.Now())
+	}
+	return defaultRetryAfter
+}
+
+// limiter is a token bucket with an optional in-flight semaphore. Its rate
+// is halved on every 429 and grows back by a tenth of the configured rate
+// on every other response.
+type limiter struct {
+	sem chan struct{}
+
+	mu      sync.Mutex
+	maxRate float64
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	paused  time.Time // no request before this, from Retry-After
+}
+
+func newLimiter(config *RateLimit) *limiter {
+	l := &limiter{maxRate: config.Rate, rate: config.Rate, burst: float64(config.Burst), last: time.Now()}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = l.burst
+	if config.MaxInFlight > 0 {
+		l.sem = make(chan struct{}, config.MaxInFlight)
+	}
+	return l
+}
+
+func (l *limiter) acquire() (release func()) {
+	if l.sem != nil {
+		l.sem <- struct{}{}
+	}
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			break
+		}
+		time.Sleep(wait)
+	}
+	if l.sem == nil {
+		return func() {}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.sem })
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before
+// trying again.
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *limiter) throttle(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(wait); until.After(l.paused) {
+		l.paused = until
+	}
+	if l.rate > 0 {
+		l.rate /= 2
+		if min := l.maxRate / 16; l.rate < min {
+			l.rate = min
+		}
+	}
+}
+
+func (l *limiter) recover() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate < l.maxRate {
+		l.rate += l.maxRate / 10
+		if l.rate > l.maxRate {
+			l.rate = l.maxRate
+		}
+	}
+}
+
+// releaseBody releases the rate limiter slot of a request once its response
+// body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
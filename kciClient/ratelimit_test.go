@@ -0,0 +1,178 @@
+package kciClient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", defaultRetryAfter},
+		{"0", 0},
+		{"5", 5 * time.Second},
+		{"soon", defaultRetryAfter},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.in); got != tt.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(date); got < 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(%q) = %v", date, got)
+	}
+}
+
+func TestEndpointGroup(t *testing.T) {
+	tests := map[string]string{
+		"/{version}/build/{proj}/{num}/{job}/log":       GroupLogs,
+		"/ws/log/{proj}/{num}/{job}":                    GroupLogs,
+		"/{version}/build/{proj}/{num}/artifact/{name}": GroupArtifacts,
+		"/{version}/project":                            GroupMetadata,
+		"/ws/feed/{user}":                               GroupMetadata,
+	}
+	for path, want := range tests {
+		if got := endpointGroup(path); got != want {
+			t.Errorf("endpointGroup(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(&RateLimit{Rate: 50, Burst: 2})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.acquire()()
+	}
+	// two from the burst, three at 20ms each
+	if d := time.Since(start); d < 50*time.Millisecond || d > time.Second {
+		t.Errorf("5 requests took %v", d)
+	}
+
+	l.throttle(0)
+	l.throttle(0)
+	if l.rate != 12.5 {
+		t.Errorf("rate after two 429s %v, want 12.5", l.rate)
+	}
+	for i := 0; i < 20; i++ {
+		l.recover()
+	}
+	if l.rate != 50 {
+		t.Errorf("recovered rate %v, want 50", l.rate)
+	}
+
+	l = newLimiter(&RateLimit{MaxInFlight: 2})
+	var inFlight, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := l.acquire()
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+	if max != 2 {
+		t.Errorf("max in flight %d, want 2", max)
+	}
+}
+
+func TestRetry429(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     *RateLimit
+		fails     int32
+		call      func(c Client) error
+		wantErr   bool
+		wantTries int32
+	}{
+		{"retried", &RateLimit{}, 2, func(c Client) error { _, err := c.ProjList(); return err }, false, 3},
+		{"retries exhausted", &RateLimit{MaxRetries: 1}, 5, func(c Client) error { _, err := c.ProjList(); return err }, true, 2},
+		{"no retries", &RateLimit{MaxRetries: -1}, 1, func(c Client) error { _, err := c.ProjList(); return err }, true, 1},
+		{"no rate limit", nil, 1, func(c Client) error { _, err := c.ProjList(); return err }, true, 1},
+		{"json body", &RateLimit{}, 1, func(c Client) error {
+			_, err := c.ProjPost(&CreateProjReq{ProjName: "p"})
+			return err
+		}, false, 2},
+		{"raw body", &RateLimit{}, 1, func(c Client) error {
+			_, err := c.ArtifactUpload(1, 2, 3, "a", onlyReader{strings.NewReader("data")})
+			return err
+		}, true, 1},
+	}
+	mac := NewMac("ak", "sk")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tries int32
+			c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&tries, 1)
+				if err := mac.VerifyRequest(r); err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				body, _ := ioutil.ReadAll(r.Body)
+				if r.Method != "GET" && len(body) == 0 {
+					http.Error(w, "empty body", http.StatusBadRequest)
+					return
+				}
+				if n <= tt.fails {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, "slow down", http.StatusTooManyRequests)
+					return
+				}
+				if r.Method == "GET" {
+					w.Write([]byte("[]"))
+					return
+				}
+				w.Write([]byte("{}"))
+			}))
+			cfg := c.(*client).config
+			cfg.RateLimit = tt.limit
+			c = NewClientWithConfig(cfg)
+			if err := tt.call(c); (err != nil) != tt.wantErr {
+				t.Errorf("error %v", err)
+			}
+			if tries != tt.wantTries {
+				t.Errorf("%d requests, want %d", tries, tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestWsRateLimit(t *testing.T) {
+	ws := &fakeWs{}
+	c := NewClientWithConfig(&ClientConfig{
+		Host:        "h",
+		WsTransport: ws,
+		RateLimit:   &RateLimit{Groups: map[string]*RateLimit{GroupLogs: {Rate: 20}}},
+	})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := c.LogWs(1, 2, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 140*time.Millisecond {
+		t.Errorf("4 dials took %v, want about 150ms", d)
+	}
+	if len(ws.dials) != 4 {
+		t.Errorf("%d dials", len(ws.dials))
+	}
+}
@@ -0,0 +1,190 @@
+package kciClient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Context is a named kci endpoint with its credentials.
+type Context struct {
+	Host      string `yaml:"host,omitempty"`
+	BaseURL   string `yaml:"baseURL,omitempty"` // overrides host and scheme
+	AK        string `yaml:"ak"`
+	SK        string `yaml:"sk"`
+	RepoType  string `yaml:"repoType,omitempty"` // repo type of remotes on unknown hosts, e.g. gitlab
+	UserAgent string `yaml:"userAgent,omitempty"`
+
+	// network settings, see ClientConfig
+	Scheme             string `yaml:"scheme,omitempty"`
+	CAFile             string `yaml:"caFile,omitempty"`
+	CertFile           string `yaml:"certFile,omitempty"`
+	KeyFile            string `yaml:"keyFile,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+	Proxy              string `yaml:"proxy,omitempty"`
+}
+
+// Config returns a client config for the context.
+func (c *Context) Config() *ClientConfig {
+	config := &ClientConfig{
+		Host:      c.Host,
+		BaseURL:   c.BaseURL,
+		AK:        c.AK,
+		SK:        c.SK,
+		UserAgent: c.UserAgent,
+
+		Scheme:             c.Scheme,
+		CAFile:             c.CAFile,
+		CertFile:           c.CertFile,
+		KeyFile:            c.KeyFile,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		Proxy:              c.Proxy,
+	}
+	if config.Host == "" {
+		config.Host = DefaultHost
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = "KCISDK / " + sdkVersion
+	}
+	return config
+}
+
+// Registry is a set of named contexts, loaded from a YAML file:
+//
+//	current: private
+//	contexts:
+//	  public:
+//	    host: kci.qiniu.com
+//	    ak: ...
+//	    sk: ...
+//	  private:
+//	    host: kci.example.com
+//	    ak: ...
+//	    sk: ...
+//	    repoType: github
+type Registry struct {
+	Current  string              `yaml:"current"`
+	Contexts map[string]*Context `yaml:"contexts"`
+
+	path string
+}
+
+// DefaultRegistryPath returns $KCI_CONFIG, or ~/.kci/config.yml.
+func DefaultRegistryPath() string {
+	if p := os.Getenv("KCI_CONFIG"); p != "" {
+		return p
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(home, ".kci", "config.yml")
+}
+
+// LoadRegistry reads the registry at path, DefaultRegistryPath if empty. A
+// missing file gives an empty registry that Save will create.
+func LoadRegistry(path string) (*Registry, error) {
+	if path == "" {
+		path = DefaultRegistryPath()
+	}
+	r := &Registry{Contexts: map[string]*Context{}, path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if r.Contexts == nil {
+		r.Contexts = map[string]*Context{}
+	}
+	return r, nil
+}
+
+// Save writes the registry back to the file it was loaded from. The file
+// holds secret keys, so it is only readable by its owner.
+func (r *Registry) Save() error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, data, 0600)
+}
+
+// Path returns the file the registry is saved to.
+func (r *Registry) Path() string {
+	return r.path
+}
+
+// Names returns the context names, sorted.
+func (r *Registry) Names() []string {
+	var names []string
+	for name := range r.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Context returns a context by name. An empty name selects $KCI_CONTEXT,
+// then the current context.
+func (r *Registry) Context(name string) (*Context, error) {
+	if name == "" {
+		name = os.Getenv("KCI_CONTEXT")
+	}
+	if name == "" {
+		name = r.Current
+	}
+	if name == "" {
+		return nil, fmt.Errorf("kciClient: no current context in %s", r.path)
+	}
+	c, ok := r.Contexts[name]
+	if !ok {
+		return nil, fmt.Errorf("kciClient: no context %q in %s", name, r.path)
+	}
+	return c, nil
+}
+
+// Client returns a client for a context, chosen as by Context.
+func (r *Registry) Client(name string) (Client, error) {
+	c, err := r.Context(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithConfig(c.Config()), nil
+}
+
+// Use makes name the current context. Call Save to persist it.
+func (r *Registry) Use(name string) error {
+	if _, ok := r.Contexts[name]; !ok {
+		return fmt.Errorf("kciClient: no context %q in %s", name, r.path)
+	}
+	r.Current = name
+	return nil
+}
+
+// Set adds or replaces a context. The first context added becomes current.
+func (r *Registry) Set(name string, c *Context) {
+	r.Contexts[name] = c
+	if r.Current == "" {
+		r.Current = name
+	}
+}
+
+// Delete removes a context.
+func (r *Registry) Delete(name string) {
+	delete(r.Contexts, name)
+	if r.Current == name {
+		r.Current = ""
+	}
+}
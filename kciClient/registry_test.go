@@ -0,0 +1,148 @@
+package kciClient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegistrySaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kci", "config.yml")
+
+	r, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Contexts) != 0 || r.Path() != path {
+		t.Fatalf("missing file: %+v", r)
+	}
+	r.Set("public", &Context{AK: "ak1", SK: "sk1"})
+	r.Set("private", &Context{Host: "kci.example.com", AK: "ak2", SK: "sk2", RepoType: "gitlab"})
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	loaded, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Current != "public" || !reflect.DeepEqual(loaded.Contexts, r.Contexts) {
+		t.Errorf("loaded %+v, want %+v", loaded, r)
+	}
+	if names := loaded.Names(); !reflect.DeepEqual(names, []string{"private", "public"}) {
+		t.Errorf("names %v", names)
+	}
+}
+
+func TestRegistryContext(t *testing.T) {
+	defer os.Setenv("KCI_CONTEXT", os.Getenv("KCI_CONTEXT"))
+	tests := []struct {
+		name    string
+		current string
+		env     string
+		arg     string
+		want    string // ak of the context, "" for an error
+	}{
+		{"current", "a", "", "", "ak-a"},
+		{"env over current", "a", "b", "", "ak-b"},
+		{"name over env", "a", "b", "a", "ak-a"},
+		{"no current", "", "", "", ""},
+		{"unknown", "a", "", "c", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("KCI_CONTEXT", tt.env)
+			r := &Registry{Current: tt.current, Contexts: map[string]*Context{
+				"a": {AK: "ak-a"},
+				"b": {AK: "ak-b"},
+			}}
+			c, err := r.Context(tt.arg)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("got %+v, want an error", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.AK != tt.want {
+				t.Errorf("got %s, want %s", c.AK, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryUseDelete(t *testing.T) {
+	r := &Registry{Contexts: map[string]*Context{}}
+	r.Set("a", &Context{})
+	r.Set("b", &Context{})
+	if r.Current != "a" {
+		t.Errorf("current %q after Set, want the first context", r.Current)
+	}
+	if err := r.Use("c"); err == nil || r.Current != "a" {
+		t.Errorf("Use of unknown context: %v, current %q", err, r.Current)
+	}
+	if err := r.Use("b"); err != nil || r.Current != "b" {
+		t.Errorf("Use: %v, current %q", err, r.Current)
+	}
+	r.Delete("b")
+	if r.Current != "" || len(r.Contexts) != 1 {
+		t.Errorf("after Delete: current %q, contexts %v", r.Current, r.Names())
+	}
+}
+
+func TestContextConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       *Context
+		host, ua  string
+		skipCheck bool
+	}{
+		{"defaults", &Context{AK: "ak", SK: "sk"}, DefaultHost, "KCISDK / " + sdkVersion, false},
+		{"set", &Context{Host: "kci.example.com", UserAgent: "me", InsecureSkipVerify: true}, "kci.example.com", "me", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.ctx.Config()
+			if c.Host != tt.host || c.UserAgent != tt.ua || c.InsecureSkipVerify != tt.skipCheck {
+				t.Errorf("got %+v", c)
+			}
+			if c.AK != tt.ctx.AK || c.SK != tt.ctx.SK {
+				t.Errorf("credentials not copied: %+v", c)
+			}
+		})
+	}
+}
+
+func TestDefaultRegistryPath(t *testing.T) {
+	defer os.Setenv("KCI_CONFIG", os.Getenv("KCI_CONFIG"))
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	tests := []struct {
+		config, home, want string
+	}{
+		{"/etc/kci.yml", "/home/me", "/etc/kci.yml"},
+		{"", "/home/me", filepath.Join("/home/me", ".kci", "config.yml")},
+	}
+	for _, tt := range tests {
+		os.Setenv("KCI_CONFIG", tt.config)
+		os.Setenv("HOME", tt.home)
+		if got := DefaultRegistryPath(); got != tt.want {
+			t.Errorf("KCI_CONFIG=%q HOME=%q: got %s, want %s", tt.config, tt.home, got, tt.want)
+		}
+	}
+}
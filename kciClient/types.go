@@ -104,6 +104,29 @@ type Build struct {
 	Jobs      []*Job `json:"jobs,omitempty"`
 }
 
+// build and job status
+const (
+	StatusSkipped  = "skipped"
+	StatusPending  = "pending"
+	StatusRunning  = "running"
+	StatusSuccess  = "success"
+	StatusFailure  = "failure"
+	StatusKilled   = "killed"
+	StatusError    = "error"
+	StatusBlocked  = "blocked"
+	StatusDeclined = "declined"
+)
+
+// IsDone reports whether status is final, after which a build and its logs
+// never change again.
+func IsDone(status string) bool {
+	switch status {
+	case StatusSkipped, StatusSuccess, StatusFailure, StatusKilled, StatusError, StatusDeclined:
+		return true
+	}
+	return false
+}
+
 type Job struct {
 	Number   int    `json:"number"`
 	Error    string `json:"error"`
@@ -116,6 +139,23 @@ type Job struct {
 	Environment map[string]string `json:"environment"`
 }
 
+// ------------------------------------------------------
+// FeedEvent is a message pushed by FeedWs when a build of one of the user's
+// projects changes
+type FeedEvent struct {
+	Project *Project `json:"project"`
+	Build   *Build   `json:"build"`
+}
+
+// ------------------------------------------------------
+// Artifact represents a file produced by a job of a build
+type Artifact struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"` // sha1, hex encoded
+	JobNum   int    `json:"jobNumber"`
+}
+
 // ------------------------------------------------------
 // Log represents a line of log during build
 type Log struct {
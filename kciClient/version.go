@@ -0,0 +1,123 @@
+package kciClient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// api versions spoken by this SDK, oldest first.
+var apiVersions = []string{"v1"}
+
+// defaultAPIVersion is assumed for servers that predate Capabilities.
+const defaultAPIVersion = "v1"
+
+// versionRetry is how long the default version is used after a failed
+// negotiation before the server is asked again.
+const versionRetry = 30 * time.Second
+
+// features reported by Capabilities
+const (
+	FeatureCancel    = "cancel"
+	FeatureSecrets   = "secrets"
+	FeatureArtifacts = "artifacts"
+)
+
+// Capabilities describes what a kci server supports.
+type Capabilities struct {
+	Versions []string `json:"versions"` // api versions, e.g. v1
+	Features []string `json:"features"`
+}
+
+// Has reports whether the server supports feature.
+func (c *Capabilities) Has(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Version returns the newest api version supported by both the server and
+// the SDK, or "" if there is none.
+func (c *Capabilities) Version() string {
+	for i := len(apiVersions) - 1; i >= 0; i-- {
+		for _, v := range c.Versions {
+			if v == apiVersions[i] {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// CapabilitiesClient is implemented by clients that can ask the server what
+// it supports. The client of NewClient implements it.
+type CapabilitiesClient interface {
+	Capabilities() (*Capabilities, error)
+}
+
+// ServerCapabilities returns what the server of c supports. Clients that are
+// not CapabilitiesClients are taken to speak the default version only, as
+// servers that predate Capabilities do.
+func ServerCapabilities(c Client) (*Capabilities, error) {
+	if cc, ok := c.(CapabilitiesClient); ok {
+		return cc.Capabilities()
+	}
+	return &Capabilities{Versions: []string{defaultAPIVersion}}, nil
+}
+
+// 获取服务端支持的 api 版本和功能, 旧版本服务端只报告 v1
+func (c *client) Capabilities() (*Capabilities, error) {
+	uri := fmt.Sprintf(pathCapabilities, c.base)
+	resp, err := c.stream(uri, "GET", nil, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return &Capabilities{Versions: []string{defaultAPIVersion}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out := new(Capabilities)
+	err = json.NewDecoder(resp.Body).Decode(out)
+	return out, err
+}
+
+// api returns the versioned base url, negotiating the version on first use.
+// If negotiation fails the default version is used.
+func (c *client) api() string {
+	return c.base + "/" + c.apiVersion()
+}
+
+// apiVersion negotiates without holding c.mu, so a slow server does not
+// serialize every call; concurrent first calls may each negotiate. An answer
+// of the server is kept for good; after a failure the default version is
+// used for versionRetry, so a failing server is not asked on every call.
+func (c *client) apiVersion() string {
+	if c.config.APIVersion != "" {
+		return c.config.APIVersion
+	}
+	c.mu.Lock()
+	version, until := c.version, c.versionUntil
+	c.mu.Unlock()
+	if version != "" && (until.IsZero() || time.Now().Before(until)) {
+		return version
+	}
+
+	caps, err := c.Capabilities()
+	switch {
+	case err != nil:
+		version, until = defaultAPIVersion, time.Now().Add(versionRetry)
+	case caps.Version() == "":
+		// nothing in common, let the server report the error
+		version, until = defaultAPIVersion, time.Time{}
+	default:
+		version, until = caps.Version(), time.Time{}
+	}
+	c.mu.Lock()
+	c.version, c.versionUntil = version, until
+	c.mu.Unlock()
+	return version
+}
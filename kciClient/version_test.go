@@ -0,0 +1,123 @@
+package kciClient
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCapabilitiesVersion(t *testing.T) {
+	tests := []struct {
+		versions []string
+		want     string
+	}{
+		{[]string{"v1"}, "v1"},
+		{[]string{"v0", "v1", "v9"}, "v1"},
+		{[]string{"v9"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		c := &Capabilities{Versions: tt.versions}
+		if got := c.Version(); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.versions, got, tt.want)
+		}
+	}
+	c := &Capabilities{Features: []string{FeatureCancel}}
+	if !c.Has(FeatureCancel) || c.Has(FeatureSecrets) {
+		t.Errorf("Has: %v", c.Features)
+	}
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	type answer struct {
+		status int
+		body   string
+	}
+	ok := answer{200, `{"versions":["v1"],"features":["cancel"]}`}
+	tests := []struct {
+		name    string
+		answers []answer // of /capabilities, the last one repeats
+		calls   int
+		asked   int // requests to /capabilities
+		expired int // requests in all, once a fallback version expired
+	}{
+		{"negotiated once", []answer{ok}, 3, 1, 1},
+		{"old server", []answer{{404, ""}}, 3, 1, 1},
+		{"no common version", []answer{{200, `{"versions":["v9"]}`}}, 3, 1, 1},
+		{"failure cached briefly", []answer{{500, ""}, ok}, 3, 1, 2},
+		{"failure again", []answer{{500, ""}}, 3, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&asked, 1)) - 1
+				if n >= len(tt.answers) {
+					n = len(tt.answers) - 1
+				}
+				w.WriteHeader(tt.answers[n].status)
+				w.Write([]byte(tt.answers[n].body))
+			})
+			mux.HandleFunc("/v1/user", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`[]`))
+			})
+			c, _ := newTestClient(t, mux)
+			config := *c.(*client).config
+			config.APIVersion = ""
+			c = NewClientWithConfig(&config)
+
+			for i := 0; i < tt.calls; i++ {
+				if _, err := c.Self(); err != nil {
+					t.Fatalf("call %d: %v", i, err)
+				}
+			}
+			if int(asked) != tt.asked {
+				t.Errorf("capabilities asked %d times, want %d", asked, tt.asked)
+			}
+
+			cl := c.(*client)
+			cl.mu.Lock()
+			if !cl.versionUntil.IsZero() {
+				cl.versionUntil = time.Now().Add(-time.Second)
+			}
+			cl.mu.Unlock()
+			for i := 0; i < 2; i++ {
+				if _, err := c.Self(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if int(asked) != tt.expired {
+				t.Errorf("capabilities asked %d times after expiry, want %d", asked, tt.expired)
+			}
+		})
+	}
+}
+
+func TestServerCapabilities(t *testing.T) {
+	m := NewMockClient()
+	m.CapabilitiesFunc = func() (*Capabilities, error) {
+		return &Capabilities{Versions: []string{"v1"}, Features: []string{FeatureArtifacts}}, nil
+	}
+	tests := []struct {
+		name    string
+		c       Client
+		feature bool
+	}{
+		{"capabilities client", m, true},
+		{"plain client", struct{ Client }{m}, false},
+		{"unprogrammed mock", NewMockClient(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caps, err := ServerCapabilities(tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if caps.Version() != "v1" || caps.Has(FeatureArtifacts) != tt.feature {
+				t.Errorf("got %+v", caps)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package kciClient
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WsTransport opens websocket connections for FeedWs and LogWs. The returned
+// channel yields the messages read and is closed when the connection ends.
+type WsTransport interface {
+	Dial(uri string, header http.Header) (<-chan []byte, error)
+}
+
+// DefaultWsTransport dials with the proxy from the environment and pings the
+// server every 30 seconds.
+var DefaultWsTransport WsTransport = &wsDialer{
+	dialer: &websocket.Dialer{
+		Proxy: http.ProxyFromEnvironment,
+	},
+}
+
+type wsDialer struct {
+	dialer *websocket.Dialer
+}
+
+func (d *wsDialer) Dial(uri string, header http.Header) (<-chan []byte, error) {
+	c, _, err := d.dialer.Dial(uri, header)
+	if err != nil {
+		return nil, err
+	}
+	msg := make(chan []byte, 10)
+	done := make(chan struct{})
+
+	go func() {
+		defer c.Close()
+		defer close(msg)
+		defer close(done)
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg <- message
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := c.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return msg, nil
+}
@@ -0,0 +1,251 @@
+// Package logexport writes build logs to files as plain text, NDJSON or gzip,
+// and bundles whole builds into tar archives.
+package logexport
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+	"github.com/u2takey/kci-sdk-go/logrender"
+)
+
+// Format is the encoding of an exported log.
+type Format int
+
+const (
+	// Text writes one line per log entry, with a header before every step.
+	Text Format = iota
+	// NDJSON writes one json object per log entry.
+	NDJSON
+)
+
+// Options controls how logs are exported.
+type Options struct {
+	Format Format
+	Gzip   bool // compress the output with gzip
+	Plain  bool // strip ANSI sequences and collapse carriage returns
+}
+
+// record is the NDJSON representation of a kciClient.Log.
+type record struct {
+	Proc string `json:"proc"`
+	Time int    `json:"time"`
+	Pod  int    `json:"pod"`
+	Out  string `json:"out"`
+}
+
+// Ext returns the file extension for logs exported with opt.
+func (opt *Options) Ext() string {
+	ext := ".log"
+	if opt.Format == NDJSON {
+		ext = ".ndjson"
+	}
+	if opt.Gzip {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// FileName returns the name used for the log of job jobNum.
+func FileName(jobNum int, opt *Options) string {
+	return fmt.Sprintf("job-%d%s", jobNum, opt.Ext())
+}
+
+// WriteLogs writes logs to w according to opt.
+func WriteLogs(w io.Writer, logs []*kciClient.Log, opt *Options) error {
+	enc := NewEncoder(w, opt)
+	for _, l := range logs {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// Encoder writes log entries one at a time, so that logs can be exported
+// while they are decoded.
+type Encoder struct {
+	w    io.Writer
+	zw   *gzip.Writer
+	json *json.Encoder
+	opt  *Options
+	proc string
+	n    int
+}
+
+// NewEncoder returns an encoder writing to w according to opt.
+func NewEncoder(w io.Writer, opt *Options) *Encoder {
+	if opt == nil {
+		opt = &Options{}
+	}
+	e := &Encoder{w: w, opt: opt}
+	if opt.Gzip {
+		e.zw = gzip.NewWriter(w)
+		e.w = e.zw
+	}
+	if opt.Format == NDJSON {
+		e.json = json.NewEncoder(e.w)
+	}
+	return e
+}
+
+// Encode writes one log entry.
+func (e *Encoder) Encode(l *kciClient.Log) error {
+	out := l.Out
+	if e.opt.Plain {
+		out = logrender.Clean(out)
+	}
+	if e.json != nil {
+		return e.json.Encode(&record{Proc: l.Proc, Time: l.Time, Pod: l.Pod, Out: out})
+	}
+
+	if e.n == 0 || l.Proc != e.proc {
+		e.proc = l.Proc
+		if _, err := fmt.Fprintf(e.w, "==> %s\n", e.proc); err != nil {
+			return err
+		}
+	}
+	e.n++
+	line := strings.TrimSuffix(out, "\n")
+	_, err := fmt.Fprintf(e.w, "[%s] %s\n", elapsed(l.Time), line)
+	return err
+}
+
+// Close flushes the gzip stream, if any. It does not close the underlying
+// writer.
+func (e *Encoder) Close() error {
+	if e.zw != nil {
+		return e.zw.Close()
+	}
+	return nil
+}
+
+// elapsed formats the seconds since the step started as mm:ss.
+func elapsed(sec int) string {
+	d := time.Duration(sec) * time.Second
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), sec%60)
+}
+
+// ExportJob streams the log of one job to path.
+func ExportJob(c kciClient.Client, projId int64, buildNum, jobNum int, path string, opt *Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := exportJob(c, projId, buildNum, jobNum, f, opt); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func exportJob(c kciClient.Client, projId int64, buildNum, jobNum int, w io.Writer, opt *Options) error {
+	enc := NewEncoder(w, opt)
+	if err := kciClient.EachBuildLog(c, projId, buildNum, jobNum, enc.Encode); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ExportBuild writes the log of every job of a build into dir, one file per
+// job, and returns the paths written. Logs are streamed to the files entry by
+// entry.
+func ExportBuild(c kciClient.Client, projId int64, buildNum int, dir string, opt *Options) ([]string, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+	build, err := c.BuildById(projId, buildNum)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, job := range build.Jobs {
+		path := filepath.Join(dir, FileName(job.Number, opt))
+		if err := ExportJob(c, projId, buildNum, job.Number, path, opt); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Bundle writes a tar archive of a build to w. The archive holds build.json,
+// the Build with its Jobs, followed by the log of every job. A tar header
+// needs the size of its file, so each log is streamed to a temporary file
+// before it is copied into the archive.
+func Bundle(c kciClient.Client, projId int64, buildNum int, w io.Writer, opt *Options) error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	build, err := c.BuildById(projId, buildNum)
+	if err != nil {
+		return err
+	}
+	modTime := build.Finished
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	tw := tar.NewWriter(w)
+	meta, err := json.MarshalIndent(build, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "build.json", bytes.NewReader(meta), int64(len(meta)), modTime); err != nil {
+		return err
+	}
+	for _, job := range build.Jobs {
+		if err := bundleJob(c, projId, buildNum, job.Number, tw, opt, modTime); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func bundleJob(c kciClient.Client, projId int64, buildNum, jobNum int, tw *tar.Writer, opt *Options, modTime time.Time) error {
+	f, err := ioutil.TempFile("", "kci-log-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := exportJob(c, projId, buildNum, jobNum, f, opt); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return writeTarFile(tw, FileName(jobNum, opt), f, size, modTime)
+}
+
+func writeTarFile(tw *tar.Writer, name string, r io.Reader, size int64, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
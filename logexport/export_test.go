@@ -0,0 +1,120 @@
+package logexport
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+var testLogs = []*kciClient.Log{
+	{Proc: "clone", Time: 0, Pod: 1, Out: "cloning\n"},
+	{Proc: "build", Time: 65, Pod: 1, Out: "\x1b[31mfail\x1b[0m\n"},
+	{Proc: "build", Time: 66, Pod: 1, Out: "done"},
+}
+
+func TestWriteLogs(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  *Options
+		want string
+	}{
+		{"text", &Options{}, "==> clone\n[00:00] cloning\n==> build\n[01:05] \x1b[31mfail\x1b[0m\n[01:06] done\n"},
+		{"text plain", &Options{Plain: true}, "==> clone\n[00:00] cloning\n==> build\n[01:05] fail\n[01:06] done\n"},
+		{"ndjson", &Options{Format: NDJSON, Plain: true},
+			`{"proc":"clone","time":0,"pod":1,"out":"cloning\n"}` + "\n" +
+				`{"proc":"build","time":65,"pod":1,"out":"fail\n"}` + "\n" +
+				`{"proc":"build","time":66,"pod":1,"out":"done"}` + "\n"},
+		{"gzip", &Options{Gzip: true, Plain: true}, "==> clone\n[00:00] cloning\n==> build\n[01:05] fail\n[01:06] done\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteLogs(&buf, testLogs, tt.opt); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.Bytes()
+			if tt.opt.Gzip {
+				zr, err := gzip.NewReader(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, err = ioutil.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func testClient() *kciClient.MockClient {
+	m := kciClient.NewMockClient()
+	m.BuildByIdFunc = func(projId int64, buildNum int) (*kciClient.Build, error) {
+		return &kciClient.Build{Number: buildNum, Jobs: []*kciClient.Job{{Number: 1}, {Number: 2}}}, nil
+	}
+	m.BuildLogsFunc = func(projId int64, buildNum, jobNum int) ([]*kciClient.Log, error) {
+		return testLogs[:jobNum], nil
+	}
+	return m
+}
+
+func TestExportBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths, err := ExportBuild(testClient(), 1, 7, dir, &Options{Format: NDJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || filepath.Base(paths[1]) != "job-2.ndjson" {
+		t.Fatalf("paths %v", paths)
+	}
+	b, err := ioutil.ReadFile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte("\n")); n != 2 {
+		t.Errorf("job-2 has %d records, want 2", n)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Bundle(testClient(), 1, 7, &buf, &Options{Plain: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"job-1.log": "==> clone\n[00:00] cloning\n",
+		"job-2.log": "==> clone\n[00:00] cloning\n==> build\n[01:05] fail\n",
+	}
+	tr := tar.NewReader(&buf)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+		b, _ := ioutil.ReadAll(tr)
+		if int64(len(b)) != hdr.Size {
+			t.Errorf("%s: size %d, read %d", hdr.Name, hdr.Size, len(b))
+		}
+		if w, ok := want[hdr.Name]; ok && string(b) != w {
+			t.Errorf("%s: got %q, want %q", hdr.Name, b, w)
+		}
+	}
+	if len(names) != 3 || names[0] != "build.json" {
+		t.Errorf("entries %v", names)
+	}
+}
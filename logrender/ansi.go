@@ -0,0 +1,258 @@
+// Package logrender cleans up and renders build output that contains ANSI
+// escape sequences and carriage-return progress bars.
+package logrender
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// CSI sequences (colors, cursor movement) and OSC sequences (titles, links)
+	ansiRe = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(?:\x07|\x1b\\\\)|\x1b[@-Z\\\\-_]")
+	// SGR sequences, the only ones that survive into html
+	sgrRe = regexp.MustCompile("\x1b\\[([0-9;]*)m")
+)
+
+// StripANSI removes all ANSI escape sequences from s.
+func StripANSI(s string) string {
+	return ansiRe.ReplaceAllString(s, "")
+}
+
+// CollapseCR applies carriage returns the way a terminal would: text after a
+// '\r' overwrites the start of the current line. "\r\n" is kept as a line end.
+// Escape sequences take no room on the line; they are kept in front of the
+// character that followed them.
+func CollapseCR(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, "\r") {
+			continue
+		}
+		// cells[n] is the n-th visible character and the escape sequences
+		// written before it
+		type cell struct {
+			esc string
+			r   rune
+		}
+		var (
+			cells   []cell
+			pending string // escape sequences not yet followed by a character
+		)
+		for _, seg := range strings.Split(line, "\r") {
+			n := 0
+			for len(seg) > 0 {
+				if loc := ansiRe.FindStringIndex(seg); loc != nil && loc[0] == 0 {
+					pending += seg[:loc[1]]
+					seg = seg[loc[1]:]
+					continue
+				}
+				r, size := utf8.DecodeRuneInString(seg)
+				seg = seg[size:]
+				if n < len(cells) {
+					cells[n] = cell{cells[n].esc + pending, r}
+				} else {
+					cells = append(cells, cell{pending, r})
+				}
+				pending = ""
+				n++
+			}
+			// sequences at the end of a segment go before the characters
+			// left over, which keep their own
+			if n < len(cells) {
+				cells[n].esc = pending + cells[n].esc
+				pending = ""
+			}
+		}
+		var buf bytes.Buffer
+		for _, c := range cells {
+			buf.WriteString(c.esc)
+			buf.WriteRune(c.r)
+		}
+		buf.WriteString(pending)
+		lines[i] = buf.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Clean strips ANSI sequences and collapses carriage returns, leaving text
+// that is fit for plain-text archives.
+func Clean(s string) string {
+	return CollapseCR(StripANSI(s))
+}
+
+var colorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// style is the SGR state in effect for a run of text.
+type style struct {
+	fg, bg          string
+	bold, underline bool
+}
+
+func (s *style) apply(params string) {
+	if params == "" {
+		*s = style{}
+		return
+	}
+	ps := strings.Split(params, ";")
+	for i := 0; i < len(ps); i++ {
+		n, err := strconv.Atoi(ps[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case n == 0:
+			*s = style{}
+		case n == 1:
+			s.bold = true
+		case n == 4:
+			s.underline = true
+		case n == 22:
+			s.bold = false
+		case n == 24:
+			s.underline = false
+		case n >= 30 && n <= 37:
+			s.fg = colorNames[n-30]
+		case n == 38:
+			var c string
+			c, i = extendedColor(ps, i)
+			s.fg = c
+		case n == 39:
+			s.fg = ""
+		case n >= 40 && n <= 47:
+			s.bg = colorNames[n-40]
+		case n == 48:
+			var c string
+			c, i = extendedColor(ps, i)
+			s.bg = c
+		case n == 49:
+			s.bg = ""
+		case n >= 90 && n <= 97:
+			s.fg = "bright-" + colorNames[n-90]
+		case n >= 100 && n <= 107:
+			s.bg = "bright-" + colorNames[n-100]
+		}
+	}
+}
+
+// extendedColor parses the arguments of the 38 or 48 at ps[i], either 5;n
+// or 2;r;g;b, and returns the color name and the index of the last argument
+// consumed. Only the first 16 of the 256 colors have a class; other colors
+// are returned as "", the default color.
+func extendedColor(ps []string, i int) (string, int) {
+	if i+1 >= len(ps) {
+		return "", len(ps) - 1
+	}
+	switch ps[i+1] {
+	case "5":
+		if i+2 >= len(ps) {
+			return "", len(ps) - 1
+		}
+		n, err := strconv.Atoi(ps[i+2])
+		switch {
+		case err != nil:
+			return "", i + 2
+		case n >= 0 && n < 8:
+			return colorNames[n], i + 2
+		case n >= 8 && n < 16:
+			return "bright-" + colorNames[n-8], i + 2
+		}
+		return "", i + 2
+	case "2":
+		last := i + 4
+		if last >= len(ps) {
+			last = len(ps) - 1
+		}
+		return "", last
+	}
+	return "", i + 1
+}
+
+func (s *style) class() string {
+	var classes []string
+	if s.fg != "" {
+		classes = append(classes, "ansi-fg-"+s.fg)
+	}
+	if s.bg != "" {
+		classes = append(classes, "ansi-bg-"+s.bg)
+	}
+	if s.bold {
+		classes = append(classes, "ansi-bold")
+	}
+	if s.underline {
+		classes = append(classes, "ansi-underline")
+	}
+	return strings.Join(classes, " ")
+}
+
+// ToHTML converts the colors of s into <span class="ansi-..."> elements and
+// escapes everything else. Carriage returns are collapsed, each character
+// keeping the colors it was written with, and escape sequences other than
+// colors are dropped.
+func ToHTML(s string) string {
+	// the characters left on screen, with the style each was written in
+	type cell struct {
+		r  rune
+		st style
+	}
+	var (
+		cells []cell
+		st    style
+		line  int // start of the current line in cells
+		col   int // cursor, relative to line
+	)
+	text := func(t string) {
+		for _, r := range StripANSI(t) {
+			switch {
+			case r == '\r':
+				col = 0
+				continue
+			case r == '\n':
+				cells = append(cells, cell{r, st})
+				line, col = len(cells), 0
+				continue
+			}
+			if line+col < len(cells) {
+				cells[line+col] = cell{r, st}
+			} else {
+				cells = append(cells, cell{r, st})
+			}
+			col++
+		}
+	}
+
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	last := 0
+	for _, m := range sgrRe.FindAllStringSubmatchIndex(s, -1) {
+		text(s[last:m[0]])
+		st.apply(s[m[2]:m[3]])
+		last = m[1]
+	}
+	text(s[last:])
+
+	var buf bytes.Buffer
+	for i := 0; i < len(cells); {
+		j := i
+		var run []rune
+		for ; j < len(cells) && cells[j].st == cells[i].st; j++ {
+			run = append(run, cells[j].r)
+		}
+		cls := cells[i].st.class()
+		if cls != "" {
+			buf.WriteString(`<span class="` + cls + `">`)
+		}
+		buf.WriteString(html.EscapeString(string(run)))
+		if cls != "" {
+			buf.WriteString("</span>")
+		}
+		i = j
+	}
+	return buf.String()
+}
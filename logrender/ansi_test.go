@@ -0,0 +1,72 @@
+package logrender
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"\x1b[1;31merror\x1b[0m", "error"},
+		{"\x1b]0;title\x07text", "text"},
+		{"10%\r50%\r100%\n", "100%\n"},
+		{"long line\rshort", "shortline"},
+		{"a\r\nb", "a\nb"},
+		{"\x1b[32m 50%\x1b[0m\r100%", "100%"},
+		{"\x1b[36m[==  ]\x1b[0m 50%\r\x1b[36m[====]\x1b[0m 100%\n", "[====] 100%\n"},
+	}
+	for _, tt := range tests {
+		if got := Clean(tt.in); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"escape", "<a>&", "&lt;a&gt;&amp;"},
+		{"color", "\x1b[31mred\x1b[0m ok", `<span class="ansi-fg-red">red</span> ok`},
+		{"bold bg", "\x1b[1;44mx", `<span class="ansi-bg-blue ansi-bold">x</span>`},
+		{"bright", "\x1b[92mx", `<span class="ansi-fg-bright-green">x</span>`},
+		{"256 standard", "\x1b[38;5;1mx", `<span class="ansi-fg-red">x</span>`},
+		{"256 bright", "\x1b[48;5;12mx", `<span class="ansi-bg-bright-blue">x</span>`},
+		{"256 other", "\x1b[31m\x1b[38;5;1mx\x1b[38;5;200my", `<span class="ansi-fg-red">x</span>y`},
+		{"256 args not codes", "\x1b[38;5;4mx", `<span class="ansi-fg-blue">x</span>`},
+		{"truecolor", "\x1b[38;2;1;4;31mx", "x"},
+		{"truecolor then bold", "\x1b[38;2;255;0;0;1mx", `<span class="ansi-bold">x</span>`},
+		{"truncated", "\x1b[38;5mx", "x"},
+		{"reset", "\x1b[4mx\x1b[mY", `<span class="ansi-underline">x</span>Y`},
+		{"other csi", "\x1b[2Kx", "x"},
+		{"progress", "\x1b[32m 50%\x1b[0m\r100%", "100%"},
+		{"colored progress", "\x1b[36m[=  ]\x1b[0m 10%\r\x1b[36m[===]\x1b[0m 90%\r\x1b[36m[====]\x1b[0m 100%\n",
+			`<span class="ansi-fg-cyan">[====]</span> 100%` + "\n"},
+		{"overwritten in part", "\x1b[31mfailing\x1b[0m\rok", `ok<span class="ansi-fg-red">iling</span>`},
+		{"color across lines", "\x1b[31ma\r\nb", `<span class="ansi-fg-red">a` + "\n" + `b</span>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapseCR(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"no cr", "no cr"},
+		{"10%\r50%\r100%", "100%"},
+		{"long line\rshort", "shortline"},
+		{"\x1b[32m 50%\x1b[0m\r100%", "\x1b[32m\x1b[0m100%"},
+		{"\x1b[31mfailing\x1b[0m\rok", "\x1b[31m\x1b[0mokiling"},
+	}
+	for _, tt := range tests {
+		if got := CollapseCR(tt.in); got != tt.want {
+			t.Errorf("CollapseCR(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package logrender
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Section is the output of one step (Log.Proc) of a job.
+type Section struct {
+	Proc  string
+	Lines []string // raw output, one entry per line
+}
+
+// Folder groups log lines into sections as they arrive. It works both on a
+// complete BuildLogs result and on lines read from LogWs.
+type Folder struct {
+	sections []*Section
+}
+
+// Add appends a log line and reports whether it started a new section.
+func (f *Folder) Add(l *kciClient.Log) bool {
+	n := len(f.sections)
+	started := n == 0 || f.sections[n-1].Proc != l.Proc
+	if started {
+		f.sections = append(f.sections, &Section{Proc: l.Proc})
+		n++
+	}
+	s := f.sections[n-1]
+	s.Lines = append(s.Lines, strings.TrimSuffix(l.Out, "\n"))
+	return started
+}
+
+// Sections returns the sections folded so far.
+func (f *Folder) Sections() []*Section {
+	return f.sections
+}
+
+// Fold groups logs into per-step sections.
+func Fold(logs []*kciClient.Log) []*Section {
+	f := new(Folder)
+	for _, l := range logs {
+		f.Add(l)
+	}
+	return f.Sections()
+}
+
+// Decode parses a message read from LogWs into a log line.
+func Decode(msg []byte) (*kciClient.Log, error) {
+	l := new(kciClient.Log)
+	err := json.Unmarshal(msg, l)
+	return l, err
+}
+
+// WriteText writes sections as plain text: a header per step followed by the
+// cleaned output.
+func WriteText(w io.Writer, sections []*Section) error {
+	for _, s := range sections {
+		if _, err := fmt.Fprintf(w, "==> %s\n", s.Proc); err != nil {
+			return err
+		}
+		for _, line := range s.Lines {
+			if _, err := fmt.Fprintln(w, Clean(line)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteHTML writes sections as collapsible <details> blocks with colors
+// converted to spans. If open is true every section starts expanded.
+func WriteHTML(w io.Writer, sections []*Section, open bool) error {
+	attr := ""
+	if open {
+		attr = " open"
+	}
+	for _, s := range sections {
+		_, err := fmt.Fprintf(w, "<details class=\"log-section\"%s><summary>%s</summary><pre>",
+			attr, html.EscapeString(s.Proc))
+		if err != nil {
+			return err
+		}
+		for _, line := range s.Lines {
+			if _, err := io.WriteString(w, ToHTML(line)+"\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "</pre></details>\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package logrender
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func TestFold(t *testing.T) {
+	logs := []*kciClient.Log{
+		{Proc: "clone", Out: "a\n"},
+		{Proc: "build", Out: "b\n"},
+		{Proc: "build", Out: "\x1b[32mc\x1b[0m\n"},
+		{Proc: "clone", Out: "d"},
+	}
+	sections := Fold(logs)
+	if len(sections) != 3 {
+		t.Fatalf("got %d sections, want 3", len(sections))
+	}
+
+	tests := []struct {
+		name string
+		fn   func(*bytes.Buffer) error
+		want string
+	}{
+		{"text", func(b *bytes.Buffer) error { return WriteText(b, sections) },
+			"==> clone\na\n==> build\nb\nc\n==> clone\nd\n"},
+		{"html", func(b *bytes.Buffer) error { return WriteHTML(b, sections[1:2], true) },
+			"<details class=\"log-section\" open><summary>build</summary><pre>b\n" +
+				"<span class=\"ansi-fg-green\">c</span>\n</pre></details>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.fn(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
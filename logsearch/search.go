@@ -0,0 +1,212 @@
+// Package logsearch greps the logs of many builds of a project concurrently.
+package logsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+	"github.com/u2takey/kci-sdk-go/logrender"
+)
+
+const defaultWorkers = 4
+
+// Query describes what to search for.
+type Query struct {
+	Pattern    string
+	Regexp     bool // treat Pattern as a regular expression instead of a literal
+	IgnoreCase bool
+	Branch     string // only search builds of this branch, empty for all
+	Builds     int    // only search the most recent builds, 0 for all
+}
+
+// Match is a log line that matched a query.
+type Match struct {
+	BuildNum int    `json:"build"`
+	JobNum   int    `json:"job"`
+	Proc     string `json:"proc"`
+	Line     int    `json:"line"` // 1-based line number in the job log
+	Text     string `json:"text"` // the line with ANSI sequences stripped
+}
+
+// Searcher runs queries against a kci client.
+type Searcher struct {
+	Client   kciClient.Client
+	Workers  int    // max builds fetched concurrently, defaults to 4
+	CacheDir string // if set, logs of finished builds are cached here, per account
+}
+
+// NewSearcher returns a searcher with the default worker count and an
+// optional on-disk cache.
+func NewSearcher(c kciClient.Client, cacheDir string) *Searcher {
+	return &Searcher{Client: c, Workers: defaultWorkers, CacheDir: cacheDir}
+}
+
+func (q *Query) matcher() (func(string) bool, error) {
+	pattern := q.Pattern
+	if !q.Regexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if q.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+// Search runs q over the builds of a project and returns the matches ordered
+// by build (newest first), job and line. When some builds fail to load, the
+// matches found so far are returned with the first error.
+func (s *Searcher) Search(projId int64, q *Query) ([]*Match, error) {
+	match, err := q.matcher()
+	if err != nil {
+		return nil, err
+	}
+	builds, err := s.Client.BuildList(projId)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byNumberDesc(builds))
+	var todo []*kciClient.Build
+	for _, b := range builds {
+		if q.Branch != "" && b.Branch != q.Branch {
+			continue
+		}
+		todo = append(todo, b)
+		if q.Builds > 0 && len(todo) == q.Builds {
+			break
+		}
+	}
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		matches  []*Match
+		firstErr error
+		queue    = make(chan *kciClient.Build)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range queue {
+				found, err := s.searchBuild(projId, b, match)
+				mu.Lock()
+				matches = append(matches, found...)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, b := range todo {
+		queue <- b
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Sort(byPosition(matches))
+	return matches, firstErr
+}
+
+func (s *Searcher) searchBuild(projId int64, b *kciClient.Build, match func(string) bool) ([]*Match, error) {
+	jobs := b.Jobs
+	if len(jobs) == 0 {
+		full, err := s.Client.BuildById(projId, b.Number)
+		if err != nil {
+			return nil, fmt.Errorf("build %d: %v", b.Number, err)
+		}
+		b, jobs = full, full.Jobs
+	}
+	var matches []*Match
+	for _, job := range jobs {
+		logs, err := s.logs(projId, b, job.Number)
+		if err != nil {
+			return matches, fmt.Errorf("build %d job %d: %v", b.Number, job.Number, err)
+		}
+		n := 0
+		for _, l := range logs {
+			for _, line := range strings.Split(strings.TrimSuffix(l.Out, "\n"), "\n") {
+				n++
+				line = logrender.Clean(line)
+				if match(line) {
+					matches = append(matches, &Match{
+						BuildNum: b.Number,
+						JobNum:   job.Number,
+						Proc:     l.Proc,
+						Line:     n,
+						Text:     line,
+					})
+				}
+			}
+		}
+	}
+	return matches, nil
+}
+
+// logs returns the log of a job, from the cache if the build is finished.
+func (s *Searcher) logs(projId int64, b *kciClient.Build, jobNum int) ([]*kciClient.Log, error) {
+	cacheable := s.CacheDir != "" && kciClient.IsDone(b.Status)
+	// logs of different servers and accounts must not share a path
+	account := kciClient.AccountKey(s.Client)
+	if account == "" {
+		account = "default"
+	}
+	path := filepath.Join(s.CacheDir, account, fmt.Sprint(projId), fmt.Sprintf("%d-%d.json", b.Number, jobNum))
+	if cacheable {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			var logs []*kciClient.Log
+			if json.Unmarshal(data, &logs) == nil {
+				return logs, nil
+			}
+		}
+	}
+	logs, err := s.Client.BuildLogs(projId, b.Number, jobNum)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		// a failed cache write only costs a refetch next time
+		if data, err := json.Marshal(logs); err == nil {
+			if os.MkdirAll(filepath.Dir(path), 0755) == nil {
+				ioutil.WriteFile(path, data, 0644)
+			}
+		}
+	}
+	return logs, nil
+}
+
+type byNumberDesc []*kciClient.Build
+
+func (p byNumberDesc) Len() int           { return len(p) }
+func (p byNumberDesc) Less(i, j int) bool { return p[i].Number > p[j].Number }
+func (p byNumberDesc) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type byPosition []*Match
+
+func (p byPosition) Len() int      { return len(p) }
+func (p byPosition) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byPosition) Less(i, j int) bool {
+	if p[i].BuildNum != p[j].BuildNum {
+		return p[i].BuildNum > p[j].BuildNum
+	}
+	if p[i].JobNum != p[j].JobNum {
+		return p[i].JobNum < p[j].JobNum
+	}
+	return p[i].Line < p[j].Line
+}
@@ -0,0 +1,88 @@
+package logsearch
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func testClient(fetches *int) *kciClient.MockClient {
+	m := kciClient.NewMockClient()
+	m.BuildListFunc = func(projId int64) ([]*kciClient.Build, error) {
+		return []*kciClient.Build{
+			{Number: 1, Branch: "master", Status: kciClient.StatusSuccess, Jobs: []*kciClient.Job{{Number: 1}}},
+			{Number: 2, Branch: "dev", Status: kciClient.StatusRunning, Jobs: []*kciClient.Job{{Number: 1}, {Number: 2}}},
+		}, nil
+	}
+	m.BuildLogsFunc = func(projId int64, buildNum, jobNum int) ([]*kciClient.Log, error) {
+		*fetches++
+		return []*kciClient.Log{
+			{Proc: "clone", Out: "cloning\n"},
+			{Proc: "test", Out: "ok a\nFAIL b\n"},
+			{Proc: "test", Out: "\x1b[31mfail c\x1b[0m\n"},
+		}, nil
+	}
+	return m
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  []Match
+	}{
+		{"literal", Query{Pattern: "FAIL"}, []Match{
+			{BuildNum: 2, JobNum: 1, Proc: "test", Line: 3, Text: "FAIL b"},
+			{BuildNum: 2, JobNum: 2, Proc: "test", Line: 3, Text: "FAIL b"},
+			{BuildNum: 1, JobNum: 1, Proc: "test", Line: 3, Text: "FAIL b"},
+		}},
+		{"ignore case ansi", Query{Pattern: "fail", IgnoreCase: true, Branch: "master"}, []Match{
+			{BuildNum: 1, JobNum: 1, Proc: "test", Line: 3, Text: "FAIL b"},
+			{BuildNum: 1, JobNum: 1, Proc: "test", Line: 4, Text: "fail c"},
+		}},
+		{"regexp latest", Query{Pattern: "^ok ", Regexp: true, Builds: 1}, []Match{
+			{BuildNum: 2, JobNum: 1, Proc: "test", Line: 2, Text: "ok a"},
+			{BuildNum: 2, JobNum: 2, Proc: "test", Line: 2, Text: "ok a"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches int
+			s := NewSearcher(testClient(&fetches), "")
+			got, err := s.Search(1, &tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d matches, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if *got[i] != tt.want[i] {
+					t.Errorf("match %d: got %+v, want %+v", i, *got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fetches int
+	s := NewSearcher(testClient(&fetches), dir)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Search(1, &Query{Pattern: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// build 1 is finished and cached, build 2 is refetched
+	if fetches != 5 {
+		t.Errorf("fetched %d logs, want 5", fetches)
+	}
+}
@@ -0,0 +1,144 @@
+// Package notifier sends build notifications from the client side. A Router
+// follows FeedWs, matches each build change against its rules and hands the
+// rendered message to the notifiers of every matching rule:
+//
+//	r := &notifier.Router{Rules: []*notifier.Rule{{
+//		Branches:  []string{"master"},
+//		Statuses:  []string{kciClient.StatusFailure, kciClient.StatusError},
+//		Notifiers: []notifier.Notifier{&notifier.SMTP{Addr: "smtp:25", From: from, To: to}},
+//	}}}
+//	r.Listen(client, userid, stop)
+package notifier
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Message is a rendered notification.
+type Message struct {
+	Subject string
+	Body    string
+	Project *kciClient.Project // may be nil
+	Build   *kciClient.Build
+}
+
+// Notifier delivers messages.
+type Notifier interface {
+	Notify(msg *Message) error
+}
+
+// Rule selects builds and the notifiers told about them. Projects and
+// Branches are path.Match patterns; an empty list matches everything, except
+// for Statuses which defaults to the finished statuses.
+type Rule struct {
+	Projects  []string // project names, or ids when the name is unknown
+	Branches  []string
+	Statuses  []string
+	Template  *Template // defaults to DefaultTemplate
+	Notifiers []Notifier
+}
+
+// Match reports whether the rule selects the build.
+func (r *Rule) Match(proj *kciClient.Project, b *kciClient.Build) bool {
+	if len(r.Statuses) == 0 {
+		if !kciClient.IsDone(b.Status) {
+			return false
+		}
+	} else if !contains(r.Statuses, b.Status) {
+		return false
+	}
+	return matchAny(r.Projects, projectName(proj, b)) && matchAny(r.Branches, b.Branch)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func projectName(proj *kciClient.Project, b *kciClient.Build) string {
+	if proj != nil && proj.ProjName != "" {
+		return proj.ProjName
+	}
+	return fmt.Sprint(b.ProjectId)
+}
+
+// ---------------------------------------------------------------------------------------
+
+// Router notifies about builds matching its rules.
+type Router struct {
+	Rules []*Rule
+
+	// OnError, if set, is told about the feed connects that failed in Listen
+	// and the messages it could not render or deliver.
+	OnError func(err error)
+}
+
+// Route sends the messages of every rule matching the build. All matching
+// notifiers are tried; the errors of those that failed are returned
+// together.
+func (r *Router) Route(proj *kciClient.Project, b *kciClient.Build) error {
+	var errs []string
+	for _, rule := range r.Rules {
+		if !rule.Match(proj, b) {
+			continue
+		}
+		t := rule.Template
+		if t == nil {
+			t = DefaultTemplate
+		}
+		msg, err := t.Render(proj, b)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, n := range rule.Notifiers {
+			if err := n.Notify(msg); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("notifier: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Listen routes the builds pushed by FeedWs until stop is closed,
+// reconnecting with backoff. A build is routed once per status even if the
+// feed repeats it.
+func (r *Router) Listen(c kciClient.Client, userid uint64, stop <-chan struct{}) {
+	kciClient.FollowFeed(c, userid, stop, func(ev *kciClient.FeedEvent) error {
+		// a failed route is not retried: the notifiers that succeeded
+		// would send their message again
+		if err := r.Route(ev.Project, ev.Build); err != nil {
+			r.error(err)
+		}
+		return nil
+	}, r.error)
+}
+
+func (r *Router) error(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+}
@@ -0,0 +1,294 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// smtpServer is an SMTP stand-in accepting one mail per connection. RCPT
+// TO of addresses in reject is refused.
+type smtpServer struct {
+	l      net.Listener
+	reject map[string]bool
+
+	mu    sync.Mutex
+	from  string
+	rcpts []string
+	data  string
+}
+
+func newSMTPServer(t *testing.T, reject ...string) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{l: l, reject: map[string]bool{}}
+	for _, r := range reject {
+		s.reject[r] = true
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			s.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			rcpt := strings.Trim(line[len("RCPT TO:"):], "<> ")
+			if s.reject[rcpt] {
+				reply("550 no such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, rcpt)
+			s.mu.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+var (
+	testProj  = &kciClient.Project{ID: 1, ProjName: "api"}
+	testBuild = &kciClient.Build{
+		Number:    7,
+		Status:    kciClient.StatusFailure,
+		Branch:    "master",
+		Commit:    "0123456789abcdef",
+		Title:     "fix it",
+		Author:    "someone",
+		Started:   time.Unix(100, 0),
+		Finished:  time.Unix(160, 0),
+		ProjectId: 1,
+	}
+)
+
+func TestSMTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		to     []string
+		reject []string
+		err    bool
+	}{
+		{"delivered", []string{"a@example.com", "b@example.com"}, nil, false},
+		{"recipient refused", []string{"a@example.com"}, []string{"a@example.com"}, true},
+		{"no recipients", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newSMTPServer(t, tt.reject...)
+			n := &SMTP{Addr: srv.l.Addr().String(), From: "kci@example.com", To: tt.to}
+			msg, err := DefaultTemplate.Render(testProj, testBuild)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = n.Notify(msg)
+			if tt.err {
+				if err == nil || !strings.HasPrefix(err.Error(), "notifier: smtp: ") {
+					t.Errorf("got %v, want a smtp error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if srv.from != "kci@example.com" || strings.Join(srv.rcpts, ",") != strings.Join(tt.to, ",") {
+				t.Errorf("envelope %s -> %v", srv.from, srv.rcpts)
+			}
+			for _, want := range []string{
+				"Subject: [kci] api #7 failure on master\r\n",
+				"To: a@example.com, b@example.com\r\n",
+				"Content-Type: text/plain; charset=utf-8\r\n",
+				"\r\nBuild #7 of api failure after 1m0s.\r\n",
+				"Commit:  01234567 fix it\r\n",
+			} {
+				if !strings.Contains(srv.data, want) {
+					t.Errorf("mail lacks %q:\n%s", want, srv.data)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    bool
+	}{
+		{"ok", 200, false},
+		{"no content", 204, false},
+		{"refused", 403, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got WebhookPayload
+			var token string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token = r.Header.Get("X-Token")
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+			n := &Webhook{URL: ts.URL, Header: http.Header{"X-Token": {"secret"}}}
+			err := n.Notify(&Message{Subject: "s", Body: "b", Project: testProj, Build: testBuild})
+			if (err != nil) != tt.err {
+				t.Fatalf("got %v, want error %v", err, tt.err)
+			}
+			if token != "secret" || got.Subject != "s" || got.Build == nil || got.Build.Number != 7 {
+				t.Errorf("token %q, payload %+v", token, got)
+			}
+		})
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	running := *testBuild
+	running.Status = kciClient.StatusRunning
+	tests := []struct {
+		name  string
+		rule  *Rule
+		proj  *kciClient.Project
+		build *kciClient.Build
+		want  bool
+	}{
+		{"finished by default", &Rule{}, testProj, testBuild, true},
+		{"running not by default", &Rule{}, testProj, &running, false},
+		{"status listed", &Rule{Statuses: []string{kciClient.StatusRunning}}, testProj, &running, true},
+		{"status not listed", &Rule{Statuses: []string{kciClient.StatusSuccess}}, testProj, testBuild, false},
+		{"project pattern", &Rule{Projects: []string{"a*"}}, testProj, testBuild, true},
+		{"project id without name", &Rule{Projects: []string{"1"}}, nil, testBuild, true},
+		{"other project", &Rule{Projects: []string{"web"}}, testProj, testBuild, false},
+		{"branch pattern", &Rule{Branches: []string{"release/*", "master"}}, testProj, testBuild, true},
+		{"other branch", &Rule{Branches: []string{"release/*"}}, testProj, testBuild, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Match(tt.proj, tt.build); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+type failing struct{}
+
+func (failing) Notify(msg *Message) error { return errors.New("down") }
+
+func TestRoute(t *testing.T) {
+	var out bytes.Buffer
+	r := &Router{Rules: []*Rule{
+		{Branches: []string{"master"}, Notifiers: []Notifier{&Writer{W: &out}, failing{}}},
+		{Template: MustTemplate("{{.Name}}\n  broke", "{{.Build.Author}}"), Notifiers: []Notifier{&Writer{W: &out}}},
+		{Branches: []string{"dev"}, Notifiers: []Notifier{failing{}}},
+	}}
+	err := r.Route(testProj, testBuild)
+	if err == nil || err.Error() != "notifier: down" {
+		t.Errorf("got %v, want the error of the failing notifier", err)
+	}
+	want := "[kci] api #7 failure on master\n" + "Build #7 of api failure after 1m0s."
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("got\n%s", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "api broke\nsomeone\n\n") {
+		t.Errorf("custom template: got\n%s", out.String())
+	}
+}
+
+func TestListen(t *testing.T) {
+	m := kciClient.NewMockClient()
+	var out bytes.Buffer
+	w := &Writer{W: &out}
+	r := &Router{Rules: []*Rule{{Template: MustTemplate("{{.Name}} #{{.Build.Number}} {{.Build.Status}}", ""), Notifiers: []Notifier{w}}}}
+
+	push := func(status string) {
+		b := *testBuild
+		b.Status = status
+		msg, _ := json.Marshal(&kciClient.FeedEvent{Project: testProj, Build: &b})
+		m.PushFeed(1, msg)
+	}
+	push(kciClient.StatusRunning) // not routed, rule wants finished builds
+	push(kciClient.StatusFailure)
+	push(kciClient.StatusFailure) // repeated by the feed
+	m.PushFeed(1, []byte("not json"))
+	m.CloseFeed(1)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Listen(m, 1, stop)
+		close(done)
+	}()
+	// the second FeedWs is the reconnect after the closed feed was drained
+	deadline := time.After(5 * time.Second)
+	for len(m.CallsTo("FeedWs")) < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("no reconnect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(stop)
+	<-done
+	if got := out.String(); got != "api #7 failure\n\n\n" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// SMTP mails messages as plain text.
+type SMTP struct {
+	Addr string    // host:port
+	Auth smtp.Auth // optional, e.g. smtp.PlainAuth
+	From string
+	To   []string
+}
+
+func (s *SMTP) Notify(msg *Message) error {
+	if len(s.To) == 0 {
+		return fmt.Errorf("notifier: smtp: no recipients")
+	}
+	var buf bytes.Buffer
+	header := [][2]string{
+		{"From", s.From},
+		{"To", strings.Join(s.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "8bit"},
+	}
+	for _, h := range header {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(msg.Body, "\n", "\r\n", -1))
+	if err := smtp.SendMail(s.Addr, s.Auth, s.From, s.To, buf.Bytes()); err != nil {
+		return fmt.Errorf("notifier: smtp: %v", err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------------------
+
+// WebhookPayload is the JSON body posted by Webhook.
+type WebhookPayload struct {
+	Subject string             `json:"subject"`
+	Body    string             `json:"body"`
+	Project *kciClient.Project `json:"project,omitempty"`
+	Build   *kciClient.Build   `json:"build"`
+}
+
+// Webhook posts messages as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Header http.Header  // extra request headers, e.g. a token
+	Client *http.Client // defaults to http.DefaultClient
+}
+
+func (w *Webhook) Notify(msg *Message) error {
+	body, err := json.Marshal(&WebhookPayload{
+		Subject: msg.Subject,
+		Body:    msg.Body,
+		Project: msg.Project,
+		Build:   msg.Build,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notifier: webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		out, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notifier: webhook: %s: %s", resp.Status, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------------------
+
+// Writer writes messages to W, e.g. os.Stdout, separated by blank lines.
+type Writer struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+func (w *Writer) Notify(msg *Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := fmt.Fprintf(w.W, "%s\n%s\n", msg.Subject, strings.TrimRight(msg.Body, "\n")+"\n")
+	return err
+}
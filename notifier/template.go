@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Data is what templates are executed with.
+type Data struct {
+	Project  *kciClient.Project // may be nil
+	Build    *kciClient.Build
+	Name     string        // project name, or its id if unknown
+	Commit   string        // short commit
+	Duration time.Duration // zero until the build finished
+}
+
+// Template renders the subject and body of messages with text/template.
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// DefaultTemplate is used by rules without a template.
+var DefaultTemplate = MustTemplate(
+	`[kci] {{.Name}} #{{.Build.Number}} {{.Build.Status}} on {{.Build.Branch}}`,
+	`Build #{{.Build.Number}} of {{.Name}} {{.Build.Status}}{{if .Duration}} after {{.Duration}}{{end}}.
+
+Branch:  {{.Build.Branch}}
+Commit:  {{.Commit}} {{.Build.Title}}
+Author:  {{.Build.Author}}{{with .Build.AuthorEmail}} <{{.}}>{{end}}
+{{with .Build.LinkUrl}}Link:    {{.}}
+{{end}}`,
+)
+
+// NewTemplate parses the subject and body templates. Subjects are joined
+// into one line when rendered.
+func NewTemplate(subject, body string) (*Template, error) {
+	s, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, err
+	}
+	b, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{subject: s, body: b}, nil
+}
+
+// MustTemplate is NewTemplate panicking on errors.
+func MustTemplate(subject, body string) *Template {
+	t, err := NewTemplate(subject, body)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render returns the message for a build.
+func (t *Template) Render(proj *kciClient.Project, b *kciClient.Build) (*Message, error) {
+	data := NewData(proj, b)
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Body:    body.String(),
+		Project: proj,
+		Build:   b,
+	}, nil
+}
+
+// NewData returns the template data of a build.
+func NewData(proj *kciClient.Project, b *kciClient.Build) *Data {
+	d := &Data{Project: proj, Build: b, Name: projectName(proj, b), Commit: b.Commit}
+	if len(d.Commit) > 8 {
+		d.Commit = d.Commit[:8]
+	}
+	if kciClient.IsDone(b.Status) && !b.Started.IsZero() && b.Finished.After(b.Started) {
+		d.Duration = b.Finished.Sub(b.Started)
+	}
+	return d
+}
@@ -0,0 +1,247 @@
+package projsync
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// ActionKind is what the reconciler does to a project.
+type ActionKind string
+
+const (
+	Create ActionKind = "create"
+	Update ActionKind = "update"
+	Delete ActionKind = "delete"
+	// Conflict marks a project whose repository differs from the spec, or a
+	// new project whose repository already has a project under another
+	// name. The repository of a project cannot be changed and a repository
+	// has one project, so either is left alone.
+	Conflict ActionKind = "conflict"
+)
+
+// Action is one step of a plan.
+type Action struct {
+	Kind    ActionKind
+	Name    string
+	ProjId  int64 // for updates, deletes and conflicts
+	Create  *kciClient.CreateProjReq
+	Patch   *kciClient.PatchProj // settings to set after create, or to update
+	Changes []string             // human readable, e.g. "timeout: 60 -> 30"
+}
+
+// Plan is the list of actions that bring the account in line with a spec.
+type Plan struct {
+	Actions   []*Action
+	Unmanaged []string // projects not in the spec, kept because prune is off
+}
+
+// Empty reports whether the plan changes nothing.
+func (p *Plan) Empty() bool {
+	for _, a := range p.Actions {
+		if a.Kind != Conflict {
+			return false
+		}
+	}
+	return true
+}
+
+// MakePlan diffs spec against the projects of the account. Projects missing
+// from the spec are deleted only with prune.
+func MakePlan(c kciClient.Client, spec *Spec, prune bool) (*Plan, error) {
+	projs, err := c.ProjList()
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]*kciClient.Project{}
+	byRepo := map[string]*kciClient.Project{}
+	for _, p := range projs {
+		existing[p.ProjName] = p
+		byRepo[repoKey(p.RepoType, p.RepoOwner, p.RepoName)] = p
+	}
+
+	plan := new(Plan)
+	wanted := map[string]bool{}
+	for _, s := range spec.Projects {
+		wanted[s.Name] = true
+		cur, ok := existing[s.Name]
+		if !ok {
+			if other := byRepo[repoKey(s.RepoType, s.RepoOwner, s.RepoName)]; other != nil {
+				plan.Actions = append(plan.Actions, &Action{
+					Kind:   Conflict,
+					Name:   s.Name,
+					ProjId: other.ID,
+					Changes: []string{fmt.Sprintf("repo: %s/%s/%s is project %s",
+						s.RepoType, s.RepoOwner, s.RepoName, other.ProjName)},
+				})
+				continue
+			}
+			patch, changes := settingsDiff(s, nil)
+			plan.Actions = append(plan.Actions, &Action{
+				Kind: Create,
+				Name: s.Name,
+				Create: &kciClient.CreateProjReq{
+					BuildLocation: s.BuildLocation,
+					ProjName:      s.Name,
+					RepoType:      s.RepoType,
+					RepoOwner:     s.RepoOwner,
+					RepoName:      s.RepoName,
+				},
+				Patch:   patch,
+				Changes: changes,
+			})
+			continue
+		}
+		if cur.RepoType != s.RepoType || cur.RepoOwner != s.RepoOwner || cur.RepoName != s.RepoName {
+			plan.Actions = append(plan.Actions, &Action{
+				Kind:   Conflict,
+				Name:   s.Name,
+				ProjId: cur.ID,
+				Changes: []string{fmt.Sprintf("repo: %s/%s/%s -> %s/%s/%s",
+					cur.RepoType, cur.RepoOwner, cur.RepoName, s.RepoType, s.RepoOwner, s.RepoName)},
+			})
+			continue
+		}
+		if patch, changes := settingsDiff(s, cur); patch != nil {
+			plan.Actions = append(plan.Actions, &Action{Kind: Update, Name: s.Name, ProjId: cur.ID, Patch: patch, Changes: changes})
+		}
+	}
+
+	var extra []*kciClient.Project
+	for _, p := range projs {
+		if !wanted[p.ProjName] {
+			extra = append(extra, p)
+		}
+	}
+	sort.Sort(byName(extra))
+	for _, p := range extra {
+		if prune {
+			plan.Actions = append(plan.Actions, &Action{Kind: Delete, Name: p.ProjName, ProjId: p.ID})
+		} else {
+			plan.Unmanaged = append(plan.Unmanaged, p.ProjName)
+		}
+	}
+	return plan, nil
+}
+
+// settingsDiff returns the patch that applies the settings of s to cur, or
+// nil if nothing differs. A nil cur means a project about to be created,
+// which is given every setting of s: the defaults of the server are not
+// known here.
+func settingsDiff(s *ProjectSpec, cur *kciClient.Project) (*kciClient.PatchProj, []string) {
+	var (
+		patch   kciClient.PatchProj
+		changes []string
+		have    = cur
+	)
+	if have == nil {
+		have = new(kciClient.Project)
+	}
+	change := func(name string, from, to interface{}) {
+		if cur == nil {
+			changes = append(changes, fmt.Sprintf("%s: %v", name, to))
+		} else {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, from, to))
+		}
+	}
+	if s.Timeout != nil && (cur == nil || *s.Timeout != cur.Timeout) {
+		patch.Timeout = s.Timeout
+		change("timeout", have.Timeout, *s.Timeout)
+	}
+	flags := []struct {
+		name string
+		want *bool
+		have bool
+		set  **bool
+	}{
+		{"pr", s.Pr, have.PrActive, &patch.PrActive},
+		{"push", s.Push, have.PushActive, &patch.PushActive},
+		{"deploy", s.Deploy, have.DeployActive, &patch.DeployActive},
+		{"tags", s.Tags, have.TagsActive, &patch.TagsActive},
+	}
+	for _, f := range flags {
+		if f.want != nil && (cur == nil || *f.want != f.have) {
+			*f.set = f.want
+			change(f.name, f.have, *f.want)
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return &patch, changes
+}
+
+// repoKey identifies a repository; owners and names are not case sensitive
+// on the forges.
+func repoKey(typ, owner, name string) string {
+	return strings.ToLower(typ + "/" + owner + "/" + name)
+}
+
+// WriteText prints the plan, one line per action.
+func (p *Plan) WriteText(w io.Writer) error {
+	if len(p.Actions) == 0 {
+		if _, err := fmt.Fprintln(w, "no changes"); err != nil {
+			return err
+		}
+	}
+	for _, a := range p.Actions {
+		sign := map[ActionKind]string{Create: "+", Update: "~", Delete: "-", Conflict: "!"}[a.Kind]
+		line := fmt.Sprintf("%s %s %s", sign, a.Kind, a.Name)
+		if len(a.Changes) > 0 {
+			line += " (" + strings.Join(a.Changes, ", ") + ")"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	for _, name := range p.Unmanaged {
+		if _, err := fmt.Fprintf(w, "  unmanaged %s (prune to delete)\n", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply carries out a plan. Every action is attempted; the failures are
+// returned together. Conflicts are skipped.
+func Apply(c kciClient.Client, plan *Plan) error {
+	var errs []string
+	for _, a := range plan.Actions {
+		if err := apply(c, a); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", a.Kind, a.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d actions failed: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func apply(c kciClient.Client, a *Action) error {
+	switch a.Kind {
+	case Create:
+		p, err := c.ProjPost(a.Create)
+		if err != nil {
+			return err
+		}
+		if a.Patch != nil {
+			_, err = c.ProjPatch(p.ID, a.Patch)
+		}
+		return err
+	case Update:
+		_, err := c.ProjPatch(a.ProjId, a.Patch)
+		return err
+	case Delete:
+		return c.ProjDel(a.ProjId)
+	}
+	return nil
+}
+
+type byName []*kciClient.Project
+
+func (p byName) Len() int           { return len(p) }
+func (p byName) Less(i, j int) bool { return p[i].ProjName < p[j].ProjName }
+func (p byName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,174 @@
+package projsync
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+var testProjects = []*kciClient.Project{
+	{ID: 1, ProjName: "api", RepoType: "github", RepoOwner: "org", RepoName: "api", Timeout: 60, PushActive: true},
+	{ID: 2, ProjName: "web", RepoType: "github", RepoOwner: "org", RepoName: "web", Timeout: 60},
+	{ID: 3, ProjName: "old", RepoType: "github", RepoOwner: "org", RepoName: "old"},
+	{ID: 4, ProjName: "legacy-docs", RepoType: "github", RepoOwner: "org", RepoName: "docs"},
+}
+
+const testSpec = `
+projects:
+  - name: api
+    repoType: github
+    repoOwner: org
+    repoName: api
+    timeout: 60
+    push: true
+  - name: web
+    repoType: github
+    repoOwner: org
+    repoName: web
+    timeout: 30
+    tags: true
+  - name: cli
+    repoType: github
+    repoOwner: org
+    repoName: cli
+    timeout: 60
+    push: true
+  - name: bare
+    repoType: github
+    repoOwner: org
+    repoName: bare
+  - name: docs
+    repoType: github
+    repoOwner: Org
+    repoName: docs
+  - name: old
+    repoType: gitlab
+    repoOwner: org
+    repoName: old
+`
+
+func testClient() *kciClient.MockClient {
+	m := kciClient.NewMockClient()
+	m.ProjListFunc = func() ([]*kciClient.Project, error) { return testProjects, nil }
+	return m
+}
+
+func TestMakePlan(t *testing.T) {
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		prune bool
+		want  string
+	}{
+		{"keep unmanaged", false, `~ update web (timeout: 60 -> 30, tags: false -> true)
++ create cli (timeout: 60, push: true)
++ create bare
+! conflict docs (repo: github/Org/docs is project legacy-docs)
+! conflict old (repo: github/org/old -> gitlab/org/old)
+  unmanaged legacy-docs (prune to delete)
+`},
+		{"prune", true, `~ update web (timeout: 60 -> 30, tags: false -> true)
++ create cli (timeout: 60, push: true)
++ create bare
+! conflict docs (repo: github/Org/docs is project legacy-docs)
+! conflict old (repo: github/org/old -> gitlab/org/old)
+- delete legacy-docs
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := MakePlan(testClient(), spec, tt.prune)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := plan.WriteText(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMakePlanEmpty(t *testing.T) {
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Projects = spec.Projects[:1]
+	plan, err := MakePlan(testClient(), spec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("plan not empty: %+v", plan.Actions)
+	}
+}
+
+func TestApply(t *testing.T) {
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := testClient()
+	m.ProjPostFunc = func(req *kciClient.CreateProjReq) (*kciClient.Project, error) {
+		if req.ProjName == "bare" {
+			return nil, errors.New("no access to repo")
+		}
+		return &kciClient.Project{ID: 10, ProjName: req.ProjName}, nil
+	}
+	m.ProjPatchFunc = func(projId int64, p *kciClient.PatchProj) (*kciClient.Project, error) {
+		return &kciClient.Project{ID: projId}, nil
+	}
+	m.ProjDelFunc = func(projId int64) error { return nil }
+
+	plan, err := MakePlan(m, spec, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Apply(m, plan)
+	if err == nil || err.Error() != "1 actions failed: create bare: no access to repo" {
+		t.Errorf("got %v", err)
+	}
+
+	m.AssertNumberOfCalls(t, "ProjPost", 2)
+	m.AssertCalled(t, "ProjPost", &kciClient.CreateProjReq{ProjName: "cli", RepoType: "github", RepoOwner: "org", RepoName: "cli"})
+	// a new project gets every setting of the spec, even ones that may be
+	// the defaults of the server
+	timeout, yes := int64(60), true
+	m.AssertCalled(t, "ProjPatch", int64(10), &kciClient.PatchProj{Timeout: &timeout, PushActive: &yes})
+	timeout = 30
+	m.AssertCalled(t, "ProjPatch", int64(2), &kciClient.PatchProj{Timeout: &timeout, TagsActive: &yes})
+	m.AssertNumberOfCalls(t, "ProjPatch", 2)
+	m.AssertCalled(t, "ProjDel", int64(4))
+	m.AssertNumberOfCalls(t, "ProjDel", 1)
+}
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		name, spec, err string
+	}{
+		{"valid", testSpec, ""},
+		{"no name", "projects:\n  - repoType: github\n", "project #1: missing name"},
+		{"no repo", "projects:\n  - name: a\n    repoType: github\n", "project a: repoType, repoOwner and repoName are required"},
+		{"twice", "projects:\n  - {name: a, repoType: t, repoOwner: o, repoName: n}\n  - {name: a, repoType: t, repoOwner: o, repoName: m}\n", "project a: defined twice"},
+		{"unknown field", "projects:\n  - name: a\n    timout: 30\n", "field timout not found"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSpec([]byte(tt.spec))
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package projsync manages kci projects declaratively: a YAML spec lists the
+// wanted projects and their settings, and the reconciler plans and applies
+// the creates, updates and deletes needed to match it.
+package projsync
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Spec is the content of a projects file:
+//
+//	projects:
+//	  - name: justtest
+//	    repoType: github
+//	    repoOwner: u2takey
+//	    repoName: justtest
+//	    timeout: 30
+//	    tags: true
+type Spec struct {
+	Projects []*ProjectSpec `yaml:"projects"`
+}
+
+// ProjectSpec is a wanted project. Settings left out are not managed.
+type ProjectSpec struct {
+	Name          string `yaml:"name"`
+	RepoType      string `yaml:"repoType"`
+	RepoOwner     string `yaml:"repoOwner"`
+	RepoName      string `yaml:"repoName"`
+	BuildLocation string `yaml:"buildLocation,omitempty"`
+
+	Timeout *int64 `yaml:"timeout,omitempty"`
+	Pr      *bool  `yaml:"pr,omitempty"`
+	Push    *bool  `yaml:"push,omitempty"`
+	Deploy  *bool  `yaml:"deploy,omitempty"`
+	Tags    *bool  `yaml:"tags,omitempty"`
+}
+
+// LoadSpec reads and validates a spec file.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(data)
+}
+
+// ParseSpec parses and validates a spec.
+func ParseSpec(data []byte) (*Spec, error) {
+	s := new(Spec)
+	if err := yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, err
+	}
+	return s, s.Validate()
+}
+
+// Validate checks that every project has a name and a repository, and that
+// names are unique.
+func (s *Spec) Validate() error {
+	seen := map[string]bool{}
+	for i, p := range s.Projects {
+		if p.Name == "" {
+			return fmt.Errorf("project #%d: missing name", i+1)
+		}
+		if p.RepoType == "" || p.RepoOwner == "" || p.RepoName == "" {
+			return fmt.Errorf("project %s: repoType, repoOwner and repoName are required", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("project %s: defined twice", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package snapshot backs up a kci account (users, projects with their
+// settings, and optionally build history and logs) to a versioned directory
+// or archive, and recreates the projects in another account.
+//
+// A snapshot directory looks like:
+//
+//	manifest.json
+//	users.json
+//	projects.json
+//	builds/<project id>.json
+//	logs/<project id>/<build>-<job>.json
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Version of the snapshot format written by Export.
+const Version = 1
+
+// Manifest describes a snapshot.
+type Manifest struct {
+	Version  int       `json:"version"`
+	Created  time.Time `json:"created"`
+	Projects int       `json:"projects"`
+	Builds   int       `json:"builds"` // builds kept per project
+	Logs     bool      `json:"logs"`
+}
+
+// ExportOptions selects what goes into a snapshot besides users and projects.
+type ExportOptions struct {
+	Builds int  // most recent builds to keep per project, 0 for none
+	Logs   bool // also keep the job logs of those builds
+}
+
+// Export writes a snapshot of the account to dir.
+func Export(c kciClient.Client, dir string, opt *ExportOptions) (*Manifest, error) {
+	if opt == nil {
+		opt = &ExportOptions{}
+	}
+	users, err := c.Self()
+	if err != nil {
+		return nil, err
+	}
+	projs, err := c.ProjList()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(dir, "users.json"), users); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(dir, "projects.json"), projs); err != nil {
+		return nil, err
+	}
+
+	if opt.Builds > 0 {
+		for _, p := range projs {
+			if err := exportBuilds(c, dir, p.ID, opt); err != nil {
+				return nil, fmt.Errorf("project %s: %v", p.ProjName, err)
+			}
+		}
+	}
+
+	m := &Manifest{
+		Version:  Version,
+		Created:  time.Now(),
+		Projects: len(projs),
+		Builds:   opt.Builds,
+		Logs:     opt.Logs && opt.Builds > 0,
+	}
+	return m, writeJSON(filepath.Join(dir, "manifest.json"), m)
+}
+
+func exportBuilds(c kciClient.Client, dir string, projId int64, opt *ExportOptions) error {
+	builds, err := c.BuildList(projId)
+	if err != nil {
+		return err
+	}
+	sort.Sort(byNumberDesc(builds))
+	if len(builds) > opt.Builds {
+		builds = builds[:opt.Builds]
+	}
+	if opt.Logs {
+		for i, b := range builds {
+			full, err := c.BuildById(projId, b.Number)
+			if err != nil {
+				return err
+			}
+			builds[i] = full
+			for _, job := range full.Jobs {
+				logs, err := c.BuildLogs(projId, b.Number, job.Number)
+				if err != nil {
+					return err
+				}
+				name := fmt.Sprintf("%d-%d.json", b.Number, job.Number)
+				if err := writeJSON(filepath.Join(dir, "logs", fmt.Sprint(projId), name), logs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return writeJSON(filepath.Join(dir, "builds", fmt.Sprintf("%d.json", projId)), builds)
+}
+
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Snapshot is a snapshot directory loaded into memory, logs excepted.
+type Snapshot struct {
+	Manifest *Manifest
+	Users    []*kciClient.User
+	Projects []*kciClient.Project
+	Builds   map[int64][]*kciClient.Build // by project id
+}
+
+// Load reads the snapshot in dir. It fails on snapshots written by a newer
+// version of this package.
+func Load(dir string) (*Snapshot, error) {
+	s := &Snapshot{Manifest: new(Manifest), Builds: map[int64][]*kciClient.Build{}}
+	if err := readJSON(filepath.Join(dir, "manifest.json"), s.Manifest); err != nil {
+		return nil, err
+	}
+	if s.Manifest.Version > Version {
+		return nil, fmt.Errorf("snapshot version %d is newer than supported version %d", s.Manifest.Version, Version)
+	}
+	if err := readJSON(filepath.Join(dir, "users.json"), &s.Users); err != nil {
+		return nil, err
+	}
+	if err := readJSON(filepath.Join(dir, "projects.json"), &s.Projects); err != nil {
+		return nil, err
+	}
+	for _, p := range s.Projects {
+		var builds []*kciClient.Build
+		err := readJSON(filepath.Join(dir, "builds", fmt.Sprintf("%d.json", p.ID)), &builds)
+		if err == nil {
+			s.Builds[p.ID] = builds
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Logs reads the saved log of a job.
+func Logs(dir string, projId int64, buildNum, jobNum int) ([]*kciClient.Log, error) {
+	var logs []*kciClient.Log
+	name := fmt.Sprintf("%d-%d.json", buildNum, jobNum)
+	err := readJSON(filepath.Join(dir, "logs", fmt.Sprint(projId), name), &logs)
+	return logs, err
+}
+
+type byNumberDesc []*kciClient.Build
+
+func (p byNumberDesc) Len() int           { return len(p) }
+func (p byNumberDesc) Less(i, j int) bool { return p[i].Number > p[j].Number }
+func (p byNumberDesc) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
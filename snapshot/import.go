@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// ImportOptions controls how projects are recreated.
+type ImportOptions struct {
+	// OwnerMap renames repository owners, e.g. when the repositories moved
+	// to another organization along with the account.
+	OwnerMap map[string]string
+	// DryRun only checks names, nothing is created.
+	DryRun bool
+}
+
+// ImportResult is the outcome for one project of a snapshot.
+type ImportResult struct {
+	Name     string
+	OldId    int64
+	Project  *kciClient.Project // the new project, nil if not created
+	Conflict bool               // the name is taken in the target account
+	Err      error
+}
+
+// ImportReport lists what happened to every project of a snapshot. Build
+// history is not imported: builds cannot be recreated through the api.
+type ImportReport struct {
+	Results []*ImportResult
+}
+
+// Created returns the projects that were created.
+func (r *ImportReport) Created() []*ImportResult {
+	return r.filter(func(res *ImportResult) bool { return res.Project != nil })
+}
+
+// Conflicts returns the projects whose name is already taken.
+func (r *ImportReport) Conflicts() []*ImportResult {
+	return r.filter(func(res *ImportResult) bool { return res.Conflict })
+}
+
+// Failed returns the projects that could not be created for other reasons.
+func (r *ImportReport) Failed() []*ImportResult {
+	return r.filter(func(res *ImportResult) bool { return res.Err != nil && !res.Conflict })
+}
+
+func (r *ImportReport) filter(keep func(*ImportResult) bool) []*ImportResult {
+	var out []*ImportResult
+	for _, res := range r.Results {
+		if keep(res) {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Import recreates the projects of the snapshot in dir, with their
+// settings, in the account of c. Every project is attempted; conflicts and
+// failures are reported rather than stopping the import.
+func Import(c kciClient.Client, dir string, opt *ImportOptions) (*ImportReport, error) {
+	if opt == nil {
+		opt = &ImportOptions{}
+	}
+	s, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	report := new(ImportReport)
+	for _, p := range s.Projects {
+		res := &ImportResult{Name: p.ProjName, OldId: p.ID}
+		report.Results = append(report.Results, res)
+
+		// the server refuses names that are taken with an error rather
+		// than with Avaliable false; only transport and server errors are
+		// failures
+		check, err := c.CheckProjName(p.ProjName)
+		switch {
+		case kciClient.IsClientError(err):
+			res.Conflict = true
+			res.Err = fmt.Errorf("project name %q is not available: %v", p.ProjName, err)
+			continue
+		case err != nil:
+			res.Err = fmt.Errorf("checking project name %q: %v", p.ProjName, err)
+			continue
+		case !check.Avaliable:
+			res.Conflict = true
+			res.Err = fmt.Errorf("project name %q is not available", p.ProjName)
+			continue
+		}
+		if opt.DryRun {
+			continue
+		}
+
+		owner := p.RepoOwner
+		if o, ok := opt.OwnerMap[owner]; ok {
+			owner = o
+		}
+		created, err := c.ProjPost(&kciClient.CreateProjReq{
+			BuildLocation: p.BuildLocation,
+			ProjName:      p.ProjName,
+			RepoType:      p.RepoType,
+			RepoOwner:     owner,
+			RepoName:      p.RepoName,
+		})
+		if err != nil {
+			res.Err = err
+			continue
+		}
+		res.Project = created
+
+		patched, err := c.ProjPatch(created.ID, &kciClient.PatchProj{
+			Timeout:      &p.Timeout,
+			PrActive:     &p.PrActive,
+			PushActive:   &p.PushActive,
+			DeployActive: &p.DeployActive,
+			TagsActive:   &p.TagsActive,
+		})
+		if err != nil {
+			res.Err = fmt.Errorf("created, but settings not restored: %v", err)
+			continue
+		}
+		res.Project = patched
+	}
+	return report, nil
+}
@@ -0,0 +1,226 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+var testProjects = []*kciClient.Project{
+	{ID: 1, ProjName: "free", RepoType: "github", RepoOwner: "old", RepoName: "a", Timeout: 30, PushActive: true},
+	{ID: 2, ProjName: "taken", RepoType: "github", RepoOwner: "old", RepoName: "b"},
+	{ID: 3, ProjName: "unchecked", RepoType: "github", RepoOwner: "old", RepoName: "c"},
+	{ID: 4, ProjName: "rejected", RepoType: "github", RepoOwner: "other", RepoName: "d"},
+	{ID: 5, ProjName: "exists", RepoType: "github", RepoOwner: "old", RepoName: "e"},
+	{ID: 6, ProjName: "overloaded", RepoType: "github", RepoOwner: "old", RepoName: "f"},
+}
+
+func sourceClient() *kciClient.MockClient {
+	m := kciClient.NewMockClient()
+	m.SelfFunc = func() ([]*kciClient.User, error) {
+		return []*kciClient.User{{ID: 1, RepoType: "github", RepoUserName: "old"}}, nil
+	}
+	m.ProjListFunc = func() ([]*kciClient.Project, error) { return testProjects, nil }
+	m.BuildListFunc = func(projId int64) ([]*kciClient.Build, error) {
+		return []*kciClient.Build{{Number: 1}, {Number: 3}, {Number: 2}}, nil
+	}
+	m.BuildByIdFunc = func(projId int64, buildNum int) (*kciClient.Build, error) {
+		return &kciClient.Build{Number: buildNum, Jobs: []*kciClient.Job{{Number: 1}}}, nil
+	}
+	m.BuildLogsFunc = func(projId int64, buildNum, jobNum int) ([]*kciClient.Log, error) {
+		return []*kciClient.Log{{Proc: "build", Out: "ok\n"}}, nil
+	}
+	return m
+}
+
+func targetClient() *kciClient.MockClient {
+	m := kciClient.NewMockClient()
+	m.CheckProjNameFunc = func(name string) (*kciClient.CheckProjNameRes, error) {
+		switch name {
+		case "taken":
+			return &kciClient.CheckProjNameRes{}, nil
+		case "unchecked":
+			return nil, errors.New("connection refused")
+		case "exists":
+			// how the real server answers for a name in use
+			return nil, &kciClient.APIError{StatusCode: 400, Message: "project name exists"}
+		case "overloaded":
+			return nil, &kciClient.APIError{StatusCode: 503, Message: "try again later"}
+		}
+		return &kciClient.CheckProjNameRes{Avaliable: true}, nil
+	}
+	m.ProjPostFunc = func(req *kciClient.CreateProjReq) (*kciClient.Project, error) {
+		if req.ProjName == "rejected" {
+			return nil, errors.New("no access to repo")
+		}
+		return &kciClient.Project{ID: 100, ProjName: req.ProjName, RepoOwner: req.RepoOwner}, nil
+	}
+	m.ProjPatchFunc = func(projId int64, p *kciClient.PatchProj) (*kciClient.Project, error) {
+		return &kciClient.Project{ID: projId, Timeout: *p.Timeout, PushActive: *p.PushActive}, nil
+	}
+	return m
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// exportArchived exports the source account and moves the snapshot through
+// an archive, as a backup would.
+func exportArchived(t *testing.T, opt *ExportOptions) string {
+	src := tempDir(t)
+	defer os.RemoveAll(src)
+	if _, err := Export(sourceClient(), src, opt); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Archive(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := tempDir(t)
+	if err := Unarchive(&buf, dst); err != nil {
+		os.RemoveAll(dst)
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		opt    *ExportOptions
+		builds int // per project
+		logs   bool
+	}{
+		{"projects only", nil, 0, false},
+		{"builds", &ExportOptions{Builds: 2}, 2, false},
+		{"builds and logs", &ExportOptions{Builds: 5, Logs: true}, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := exportArchived(t, tt.opt)
+			defer os.RemoveAll(dir)
+
+			s, err := Load(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Manifest.Version != Version || s.Manifest.Projects != len(testProjects) || s.Manifest.Logs != tt.logs {
+				t.Errorf("manifest %+v", s.Manifest)
+			}
+			if len(s.Users) != 1 || s.Users[0].RepoUserName != "old" {
+				t.Errorf("users %+v", s.Users)
+			}
+			if len(s.Projects) != len(testProjects) || s.Projects[0].Timeout != 30 {
+				t.Errorf("projects %+v", s.Projects)
+			}
+			builds := s.Builds[1]
+			if len(builds) != tt.builds {
+				t.Fatalf("got %d builds, want %d", len(builds), tt.builds)
+			}
+			if tt.builds > 0 && builds[0].Number != 3 {
+				t.Errorf("builds not newest first: %d", builds[0].Number)
+			}
+			logs, err := Logs(dir, 1, 3, 1)
+			if tt.logs && (err != nil || len(logs) != 1 || logs[0].Out != "ok\n") {
+				t.Errorf("logs %v, %v", logs, err)
+			}
+			if !tt.logs && !os.IsNotExist(err) {
+				t.Errorf("logs saved without Logs: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if err := writeJSON(dir+"/manifest.json", &Manifest{Version: Version + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("loaded a snapshot of a newer version")
+	}
+}
+
+func TestUnarchiveBadPath(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	zw.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if err := Unarchive(&buf, dir); err == nil {
+		t.Error("extracted an entry outside the directory")
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := exportArchived(t, nil)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		opt       *ImportOptions
+		created   []string
+		conflicts []string
+		failed    []string
+		posts     int
+	}{
+		{"import", &ImportOptions{OwnerMap: map[string]string{"old": "new"}},
+			[]string{"free"}, []string{"taken", "exists"}, []string{"unchecked", "rejected", "overloaded"}, 2},
+		{"dry run", &ImportOptions{DryRun: true},
+			nil, []string{"taken", "exists"}, []string{"unchecked", "overloaded"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := targetClient()
+			report, err := Import(c, dir, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check := func(kind string, got []*ImportResult, want []string) {
+				var names []string
+				for _, res := range got {
+					names = append(names, res.Name)
+				}
+				if len(names) != len(want) {
+					t.Errorf("%s: got %v, want %v", kind, names, want)
+					return
+				}
+				for i := range names {
+					if names[i] != want[i] {
+						t.Errorf("%s: got %v, want %v", kind, names, want)
+						return
+					}
+				}
+			}
+			check("created", report.Created(), tt.created)
+			check("conflicts", report.Conflicts(), tt.conflicts)
+			check("failed", report.Failed(), tt.failed)
+			c.AssertNumberOfCalls(t, "ProjPost", tt.posts)
+			if tt.posts > 0 {
+				c.AssertCalled(t, "ProjPost", &kciClient.CreateProjReq{
+					ProjName: "free", RepoType: "github", RepoOwner: "new", RepoName: "a",
+				})
+				if p := report.Created()[0].Project; p.Timeout != 30 || !p.PushActive {
+					t.Errorf("settings not restored: %+v", p)
+				}
+			}
+		})
+	}
+}
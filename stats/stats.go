@@ -0,0 +1,183 @@
+// Package stats summarizes queue and run times of builds and jobs, and
+// compares two time windows to catch pipeline slowdowns.
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// GroupBy selects the key builds are grouped by. Keys other than those of
+// ByProject are prefixed with the project id, e.g. "12/master", so that the
+// groups of different projects stay apart.
+type GroupBy int
+
+const (
+	ByProject GroupBy = iota
+	ByBranch
+	ByEvent
+	ByJob // every job is a sample, keyed by its number; needs Build.Jobs
+)
+
+// Window is the half-open time range [From, To). Builds are placed in a
+// window by their Created time. A zero bound is unbounded.
+type Window struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains reports whether t falls in w.
+func (w Window) Contains(t time.Time) bool {
+	if !w.From.IsZero() && t.Before(w.From) {
+		return false
+	}
+	if !w.To.IsZero() && !t.Before(w.To) {
+		return false
+	}
+	return true
+}
+
+// Percentiles of a set of durations.
+type Percentiles struct {
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// Summary holds the figures of one group.
+type Summary struct {
+	Key   string
+	Count int
+	Queue Percentiles // time from enqueue to start
+	Run   Percentiles // time from start to finish
+}
+
+// sample is the queue and run time of one build or job.
+type sample struct {
+	key        string
+	queue, run time.Duration
+}
+
+// Summarize groups the finished builds created in w and computes their
+// queue and run time percentiles. Builds of several projects may be mixed.
+// Summaries are ordered by key.
+func Summarize(builds []*kciClient.Build, w Window, by GroupBy) []*Summary {
+	groups := map[string][]sample{}
+	for _, b := range builds {
+		if !kciClient.IsDone(b.Status) || !w.Contains(b.Created) {
+			continue
+		}
+		for _, s := range samples(b, by) {
+			groups[s.key] = append(groups[s.key], s)
+		}
+	}
+
+	var out []*Summary
+	for key, ss := range groups {
+		queue := make([]time.Duration, len(ss))
+		run := make([]time.Duration, len(ss))
+		for i, s := range ss {
+			queue[i], run[i] = s.queue, s.run
+		}
+		out = append(out, &Summary{
+			Key:   key,
+			Count: len(ss),
+			Queue: percentiles(queue),
+			Run:   percentiles(run),
+		})
+	}
+	sort.Sort(byKey(out))
+	return out
+}
+
+func samples(b *kciClient.Build, by GroupBy) []sample {
+	if by == ByJob {
+		var out []sample
+		for _, j := range b.Jobs {
+			if j.Started == 0 || j.Finished == 0 {
+				continue
+			}
+			out = append(out, sample{
+				key:   fmt.Sprintf("%d/%d", b.ProjectId, j.Number),
+				queue: unixSub(j.Started, j.Enqueued),
+				run:   unixSub(j.Finished, j.Started),
+			})
+		}
+		return out
+	}
+	if b.Started.IsZero() || b.Finished.IsZero() {
+		return nil
+	}
+	enqueued := b.Enqueued
+	if enqueued.IsZero() {
+		enqueued = b.Created
+	}
+	s := sample{queue: nonNegative(b.Started.Sub(enqueued)), run: nonNegative(b.Finished.Sub(b.Started))}
+	switch by {
+	case ByBranch:
+		s.key = fmt.Sprintf("%d/%s", b.ProjectId, b.Branch)
+	case ByEvent:
+		s.key = fmt.Sprintf("%d/%s", b.ProjectId, b.Event)
+	default:
+		s.key = fmt.Sprint(b.ProjectId)
+	}
+	return []sample{s}
+}
+
+func unixSub(a, b int64) time.Duration {
+	if b == 0 {
+		return 0
+	}
+	return nonNegative(time.Duration(a-b) * time.Second)
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func percentiles(ds []time.Duration) Percentiles {
+	if len(ds) == 0 {
+		return Percentiles{}
+	}
+	sort.Sort(durations(ds))
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return Percentiles{
+		Mean: sum / time.Duration(len(ds)),
+		P50:  rank(ds, 50),
+		P90:  rank(ds, 90),
+		P99:  rank(ds, 99),
+		Max:  ds[len(ds)-1],
+	}
+}
+
+// rank returns the p-th percentile of sorted ds using the nearest-rank method.
+func rank(ds []time.Duration, p int) time.Duration {
+	n := (p*len(ds) + 99) / 100
+	if n < 1 {
+		n = 1
+	}
+	return ds[n-1]
+}
+
+type durations []time.Duration
+
+func (p durations) Len() int           { return len(p) }
+func (p durations) Less(i, j int) bool { return p[i] < p[j] }
+func (p durations) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+type byKey []*Summary
+
+func (p byKey) Len() int           { return len(p) }
+func (p byKey) Less(i, j int) bool { return p[i].Key < p[j].Key }
+func (p byKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
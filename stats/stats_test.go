@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+func TestPercentiles(t *testing.T) {
+	secs := func(ns ...int) []time.Duration {
+		var ds []time.Duration
+		for _, n := range ns {
+			ds = append(ds, time.Duration(n)*time.Second)
+		}
+		return ds
+	}
+	s := time.Second
+	tests := []struct {
+		name string
+		in   []time.Duration
+		want Percentiles
+	}{
+		{"empty", nil, Percentiles{}},
+		{"one", secs(7), Percentiles{7 * s, 7 * s, 7 * s, 7 * s, 7 * s}},
+		{"unsorted", secs(4, 1, 3, 2), Percentiles{2500 * time.Millisecond, 2 * s, 4 * s, 4 * s, 4 * s}},
+		{"ten", secs(10, 9, 8, 7, 6, 5, 4, 3, 2, 1), Percentiles{5500 * time.Millisecond, 5 * s, 9 * s, 10 * s, 10 * s}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentiles(tt.in); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	hundred := make([]time.Duration, 100)
+	for i := range hundred {
+		hundred[i] = time.Duration(100-i) * time.Second
+	}
+	if p := percentiles(hundred); p.P50 != 50*s || p.P90 != 90*s || p.P99 != 99*s {
+		t.Errorf("hundred: got %+v", p)
+	}
+}
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func build(proj int64, branch, event string, queue, run int) *kciClient.Build {
+	started := t0.Add(time.Duration(queue) * time.Second)
+	return &kciClient.Build{
+		ProjectId: proj,
+		Branch:    branch,
+		Event:     event,
+		Status:    kciClient.StatusSuccess,
+		Created:   t0,
+		Enqueued:  t0,
+		Started:   started,
+		Finished:  started.Add(time.Duration(run) * time.Second),
+		Jobs: []*kciClient.Job{{
+			Number:   1,
+			Enqueued: t0.Unix(),
+			Started:  started.Unix(),
+			Finished: started.Unix() + int64(run),
+		}},
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	builds := []*kciClient.Build{
+		build(1, "master", "push", 1, 10),
+		build(1, "master", "push", 3, 20),
+		build(2, "master", "pull_request", 5, 30),
+		{ProjectId: 1, Branch: "master", Status: kciClient.StatusRunning, Created: t0},
+	}
+	tests := []struct {
+		by   GroupBy
+		want map[string]int
+	}{
+		{ByProject, map[string]int{"1": 2, "2": 1}},
+		{ByBranch, map[string]int{"1/master": 2, "2/master": 1}},
+		{ByEvent, map[string]int{"1/push": 2, "2/pull_request": 1}},
+		{ByJob, map[string]int{"1/1": 2, "2/1": 1}},
+	}
+	for _, tt := range tests {
+		got := map[string]int{}
+		for _, s := range Summarize(builds, Window{}, tt.by) {
+			got[s.Key] = s.Count
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("group by %d: got %v, want %v", tt.by, got, tt.want)
+		}
+	}
+
+	s := Summarize(builds, Window{}, ByBranch)[0]
+	if s.Queue.P50 != time.Second || s.Run.Max != 20*time.Second {
+		t.Errorf("1/master: got %+v", s)
+	}
+	if n := len(Summarize(builds, Window{From: t0.Add(time.Hour)}, ByProject)); n != 0 {
+		t.Errorf("window after all builds: got %d summaries", n)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := build(1, "master", "push", 10, 100)
+	after := build(1, "master", "push", 10, 150)
+	after.Created = t0.Add(time.Hour)
+	only := build(2, "dev", "push", 1, 1)
+
+	trends := Compare([]*kciClient.Build{before, after, only},
+		Window{To: t0.Add(time.Minute)}, Window{From: t0.Add(time.Minute)}, ByBranch)
+	if len(trends) != 2 || trends[0].Key != "1/master" || trends[1].Key != "2/dev" {
+		t.Fatalf("got %+v", trends)
+	}
+	if c := trends[0].RunChange(); c != 0.5 || !trends[0].Slower(0.2) || trends[0].QueueChange() != 0 {
+		t.Errorf("1/master: run change %v", c)
+	}
+	if trends[1].After != nil || trends[1].Slower(0) {
+		t.Errorf("2/dev: got %+v", trends[1])
+	}
+}
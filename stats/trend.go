@@ -0,0 +1,103 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// Trend compares a group across two windows.
+type Trend struct {
+	Key    string
+	Before *Summary // nil if the group had no builds in the first window
+	After  *Summary // nil if the group had no builds in the second window
+}
+
+// QueueChange is the relative change of the p50 queue time, e.g. 0.25 for
+// 25% slower. It is 0 when either window is empty.
+func (t *Trend) QueueChange() float64 {
+	if t.Before == nil || t.After == nil {
+		return 0
+	}
+	return change(t.Before.Queue.P50, t.After.Queue.P50)
+}
+
+// RunChange is the relative change of the p50 run time.
+func (t *Trend) RunChange() float64 {
+	if t.Before == nil || t.After == nil {
+		return 0
+	}
+	return change(t.Before.Run.P50, t.After.Run.P50)
+}
+
+// Slower reports whether the p50 queue or run time grew by more than
+// threshold, e.g. 0.2 for 20%.
+func (t *Trend) Slower(threshold float64) bool {
+	return t.QueueChange() > threshold || t.RunChange() > threshold
+}
+
+func change(before, after time.Duration) float64 {
+	if before == 0 {
+		return 0
+	}
+	return float64(after-before) / float64(before)
+}
+
+// Compare summarizes builds in two windows and pairs up the groups.
+func Compare(builds []*kciClient.Build, before, after Window, by GroupBy) []*Trend {
+	var (
+		trends []*Trend
+		index  = map[string]*Trend{}
+	)
+	get := func(key string) *Trend {
+		t := index[key]
+		if t == nil {
+			t = &Trend{Key: key}
+			index[key] = t
+			trends = append(trends, t)
+		}
+		return t
+	}
+	for _, s := range Summarize(builds, before, by) {
+		get(s.Key).Before = s
+	}
+	for _, s := range Summarize(builds, after, by) {
+		get(s.Key).After = s
+	}
+	sort.Sort(trendsByKey(trends))
+	return trends
+}
+
+// ForProjects fetches the build history of each project and returns it as
+// one slice, ready for Summarize or Compare. With withJobs, builds missing
+// their jobs are fetched one by one, which ByJob needs.
+func ForProjects(c kciClient.Client, withJobs bool, projIds ...int64) ([]*kciClient.Build, error) {
+	var out []*kciClient.Build
+	for _, id := range projIds {
+		builds, err := c.BuildList(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range builds {
+			if b.ProjectId == 0 {
+				b.ProjectId = id
+			}
+			if withJobs && len(b.Jobs) == 0 && kciClient.IsDone(b.Status) {
+				full, err := c.BuildById(id, b.Number)
+				if err != nil {
+					return nil, err
+				}
+				b.Jobs = full.Jobs
+			}
+		}
+		out = append(out, builds...)
+	}
+	return out, nil
+}
+
+type trendsByKey []*Trend
+
+func (p trendsByKey) Len() int           { return len(p) }
+func (p trendsByKey) Less(i, j int) bool { return p[i].Key < p[j].Key }
+func (p trendsByKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
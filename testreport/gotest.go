@@ -0,0 +1,88 @@
+package testreport
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	goRunRe    = regexp.MustCompile(`^=== (RUN|CONT|PAUSE|NAME)\s+(\S+)`)
+	goResultRe = regexp.MustCompile(`^(\s*)--- (PASS|FAIL|SKIP): (\S+) \(([0-9.]+)s\)`)
+	goPkgRe    = regexp.MustCompile(`^(ok|FAIL)\s+(\S+)\s+(?:([0-9.]+)s|\(cached\))`)
+)
+
+// parseGo recognizes the output of `go test -v`.
+func parseGo(lines []string) []*Package {
+	var (
+		pkgs    []*Package
+		pending []*Test // tests seen since the last package summary
+		byName  = map[string]*Test{}
+		current *Test // test the next output line belongs to
+		last    *Test // last finished test, for trailing indented output
+	)
+	for _, line := range lines {
+		if m := goRunRe.FindStringSubmatch(line); m != nil {
+			t, ok := byName[m[2]]
+			if !ok {
+				t = &Test{Name: m[2]}
+				byName[m[2]] = t
+				pending = append(pending, t)
+			}
+			current, last = t, nil
+			continue
+		}
+		if m := goResultRe.FindStringSubmatch(line); m != nil {
+			t, ok := byName[m[3]]
+			if !ok {
+				t = &Test{Name: m[3]}
+				byName[m[3]] = t
+				pending = append(pending, t)
+			}
+			t.Status = strings.ToLower(m[2])
+			t.Duration = seconds(m[4])
+			current, last = nil, t
+			continue
+		}
+		if m := goPkgRe.FindStringSubmatch(line); m != nil {
+			p := &Package{Name: m[2], Status: Pass, Duration: seconds(m[3]), Tests: pending}
+			if m[1] == "FAIL" {
+				p.Status = Fail
+			}
+			pkgs = append(pkgs, p)
+			pending, byName, current, last = nil, map[string]*Test{}, nil, nil
+			continue
+		}
+		if line == "PASS" || line == "FAIL" {
+			continue
+		}
+		switch {
+		case current != nil:
+			current.Output = append(current.Output, line)
+		case last != nil && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			last.Output = append(last.Output, line)
+		}
+	}
+
+	// output cut short (e.g. a killed build): keep what we have, tests that
+	// never reported a result count as failed.
+	if len(pending) > 0 {
+		p := &Package{Name: "unknown", Status: Fail, Tests: pending}
+		for _, t := range pending {
+			if t.Status == "" {
+				t.Status = Fail
+			}
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+func seconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
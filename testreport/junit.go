@@ -0,0 +1,91 @@
+package testreport
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name      `xml:"testsuites"`
+	Tests    int           `xml:"tests,attr"`
+	Failures int           `xml:"failures,attr"`
+	Skipped  int           `xml:"skipped,attr"`
+	Time     string        `xml:"time,attr"`
+	Suites   []*junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Cases    []*junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes r as JUnit XML.
+func WriteJUnit(w io.Writer, r *Report) error {
+	out := new(junitSuites)
+	var total time.Duration
+	for _, p := range r.Packages {
+		pass, fail, skip := p.Counts()
+		s := &junitSuite{
+			Name:     p.Name,
+			Tests:    pass + fail + skip,
+			Failures: fail,
+			Skipped:  skip,
+			Time:     junitTime(p.Duration),
+		}
+		for _, t := range p.Tests {
+			c := &junitCase{ClassName: p.Name, Name: t.Name, Time: junitTime(t.Duration)}
+			output := strings.Join(t.Output, "\n")
+			switch t.Status {
+			case Fail:
+				c.Failure = &junitMessage{Message: "Failed", Body: output}
+			case Skip:
+				c.Skipped = &junitMessage{Message: "Skipped", Body: output}
+			default:
+				c.SystemOut = output
+			}
+			s.Cases = append(s.Cases, c)
+		}
+		out.Suites = append(out.Suites, s)
+		out.Tests += s.Tests
+		out.Failures += s.Failures
+		out.Skipped += s.Skipped
+		total += p.Duration
+	}
+	out.Time = junitTime(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,42 @@
+package testreport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	r := &Report{Packages: []*Package{{
+		Name:     "example.com/a",
+		Status:   Fail,
+		Duration: 1500 * time.Millisecond,
+		Tests: []*Test{
+			{Name: "TestA", Status: Pass, Duration: 10 * time.Millisecond, Output: []string{"hi"}},
+			{Name: "TestB", Status: Fail, Output: []string{"a < b", "boom"}},
+			{Name: "TestC", Status: Skip},
+		},
+	}}}
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" skipped="1" time="1.500">
+  <testsuite name="example.com/a" tests="3" failures="1" skipped="1" time="1.500">
+    <testcase classname="example.com/a" name="TestA" time="0.010">
+      <system-out>hi</system-out>
+    </testcase>
+    <testcase classname="example.com/a" name="TestB" time="0.000">
+      <failure message="Failed">a &lt; b&#xA;boom</failure>
+    </testcase>
+    <testcase classname="example.com/a" name="TestC" time="0.000">
+      <skipped message="Skipped"></skipped>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,122 @@
+// Package testreport extracts structured test results from job logs and
+// writes them as JUnit XML.
+package testreport
+
+import (
+	"strings"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+	"github.com/u2takey/kci-sdk-go/logrender"
+)
+
+// test status
+const (
+	Pass = "pass"
+	Fail = "fail"
+	Skip = "skip"
+)
+
+// Report is the result of all test suites found in a log.
+type Report struct {
+	Packages []*Package
+}
+
+// Package is a go package, or for TAP output, the step that printed it.
+type Package struct {
+	Name     string
+	Status   string
+	Duration time.Duration
+	Tests    []*Test
+}
+
+// Test is a single test case.
+type Test struct {
+	Name     string
+	Status   string
+	Duration time.Duration
+	Output   []string
+}
+
+// Options controls which formats are recognized.
+type Options struct {
+	TAP bool // also recognize TAP output
+}
+
+// Counts returns the number of passed, failed and skipped tests.
+func (p *Package) Counts() (pass, fail, skip int) {
+	for _, t := range p.Tests {
+		switch t.Status {
+		case Pass:
+			pass++
+		case Fail:
+			fail++
+		case Skip:
+			skip++
+		}
+	}
+	return
+}
+
+// Failed reports whether any test or package of the report failed.
+func (r *Report) Failed() bool {
+	for _, p := range r.Packages {
+		if p.Status == Fail {
+			return true
+		}
+		if _, fail, _ := p.Counts(); fail > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// FromLogs parses the output of a job. Lines are grouped by step so that TAP
+// output of different steps ends up in different packages.
+func FromLogs(logs []*kciClient.Log, opt *Options) *Report {
+	if opt == nil {
+		opt = &Options{}
+	}
+	report := new(Report)
+	var (
+		proc  string
+		lines []string
+	)
+	flush := func() {
+		if len(lines) > 0 {
+			report.Packages = append(report.Packages, parse(proc, lines, opt)...)
+		}
+		lines = nil
+	}
+	for i, l := range logs {
+		if i == 0 || l.Proc != proc {
+			flush()
+			proc = l.Proc
+		}
+		out := strings.TrimSuffix(l.Out, "\n")
+		for _, line := range strings.Split(out, "\n") {
+			lines = append(lines, logrender.Clean(line))
+		}
+	}
+	flush()
+	return report
+}
+
+// FromJob fetches the log of a job and parses it.
+func FromJob(c kciClient.Client, projId int64, buildNum, jobNum int, opt *Options) (*Report, error) {
+	logs, err := c.BuildLogs(projId, buildNum, jobNum)
+	if err != nil {
+		return nil, err
+	}
+	return FromLogs(logs, opt), nil
+}
+
+func parse(proc string, lines []string, opt *Options) []*Package {
+	pkgs := parseGo(lines)
+	if opt.TAP {
+		if p := parseTAP(proc, lines); p != nil {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs
+}
@@ -0,0 +1,126 @@
+package testreport
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// summary flattens a report into "package status: test=status ..." lines.
+func summary(r *Report) []string {
+	var out []string
+	for _, p := range r.Packages {
+		s := p.Name + " " + p.Status + ":"
+		for _, t := range p.Tests {
+			s += " " + t.Name + "=" + t.Status
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func logsOf(proc, out string) []*kciClient.Log {
+	var logs []*kciClient.Log
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if line != "" {
+			logs = append(logs, &kciClient.Log{Proc: proc, Out: line})
+		}
+	}
+	return logs
+}
+
+func TestFromLogs(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		tap  bool
+		want []string
+	}{
+		{"go", `=== RUN   TestA
+--- PASS: TestA (0.01s)
+=== RUN   TestB
+    b_test.go:3: boom
+--- FAIL: TestB (0.00s)
+=== RUN   TestC
+--- SKIP: TestC (0.00s)
+FAIL
+FAIL	example.com/a	0.02s
+`, false, []string{"example.com/a fail: TestA=pass TestB=fail TestC=skip"}},
+		{"go parallel with NAME", `=== RUN   TestP
+=== PAUSE TestP
+=== RUN   TestQ
+=== PAUSE TestQ
+=== CONT  TestP
+=== CONT  TestQ
+=== NAME  TestP
+    p_test.go:9: from P
+--- FAIL: TestP (0.10s)
+--- PASS: TestQ (0.10s)
+FAIL
+FAIL	example.com/p	0.10s
+`, false, []string{"example.com/p fail: TestP=fail TestQ=pass"}},
+		{"go subtests cached", `=== RUN   TestS
+=== RUN   TestS/one
+--- PASS: TestS (0.00s)
+    --- PASS: TestS/one (0.00s)
+PASS
+ok  	example.com/s	(cached)
+`, false, []string{"example.com/s pass: TestS=pass TestS/one=pass"}},
+		{"go cut short", `=== RUN   TestK
+`, false, []string{"unknown fail: TestK=fail"}},
+		{"tap", `1..4
+ok 1 - first
+not ok 2 - second
+ok 3 - third # SKIP no db
+not ok 4 # TODO later
+`, true, []string{"test fail: first=pass second=fail third=skip test 4=skip"}},
+		{"go summary is not tap", `1..1
+ok 1 - only
+=== RUN   TestA
+--- PASS: TestA (0.01s)
+PASS
+ok  	example.com/a	0.12s
+`, true, []string{"example.com/a pass: TestA=pass", "test pass: only=pass"}},
+		{"tap trailing plan", `ok 1 - first
+# diagnostic
+not ok 2 - second
+1..2
+`, true, []string{"test fail: first=pass second=fail"}},
+		{"tap off", "1..1\nnot ok 1 - x\n", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := FromLogs(logsOf("test", tt.out), &Options{TAP: tt.tap})
+			if got := summary(r); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutput(t *testing.T) {
+	r := FromLogs(logsOf("test", `=== RUN   TestP
+=== RUN   TestQ
+=== NAME  TestP
+    p_test.go:9: from P
+--- FAIL: TestP (1.50s)
+=== NAME  TestQ
+    q_test.go:3: from Q
+--- PASS: TestQ (0.00s)
+FAIL	example.com/p	1.50s
+`), nil)
+	p := r.Packages[0].Tests[0]
+	if p.Duration != 1500*time.Millisecond || !reflect.DeepEqual(p.Output, []string{"    p_test.go:9: from P"}) {
+		t.Errorf("TestP: %v %q", p.Duration, p.Output)
+	}
+	q := r.Packages[0].Tests[1]
+	if !reflect.DeepEqual(q.Output, []string{"    q_test.go:3: from Q"}) {
+		t.Errorf("TestQ: %q", q.Output)
+	}
+	if !r.Failed() {
+		t.Error("report not failed")
+	}
+}
@@ -0,0 +1,72 @@
+package testreport
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	tapPlanRe = regexp.MustCompile(`^1\.\.(\d+)`)
+	// the test number is required so that go test summaries, "ok  \tpkg\t0.1s",
+	// are not taken for results
+	tapResultRe = regexp.MustCompile(`^(not ok|ok) (\d+)\b\s*-?\s*([^#]*)(?:#\s*(\w+))?`)
+)
+
+// parseTAP recognizes Test Anything Protocol output. The plan may come
+// first or last, as TAP allows; it returns nil if lines hold neither a plan
+// nor a result.
+func parseTAP(name string, lines []string) *Package {
+	var (
+		p    *Package
+		last *Test
+		yaml bool
+	)
+	for _, line := range lines {
+		if tapPlanRe.MatchString(line) {
+			if p == nil {
+				p = &Package{Name: name, Status: Pass}
+			}
+			continue
+		}
+		if m := tapResultRe.FindStringSubmatch(line); m != nil {
+			if p == nil {
+				p = &Package{Name: name, Status: Pass}
+			}
+			t := &Test{Name: strings.TrimSpace(m[3]), Status: Pass}
+			if t.Name == "" {
+				t.Name = "test " + m[2]
+			}
+			if m[1] == "not ok" {
+				t.Status = Fail
+			}
+			switch strings.ToUpper(m[4]) {
+			case "SKIP":
+				t.Status = Skip
+			case "TODO":
+				// failing TODO tests do not fail the suite
+				if t.Status == Fail {
+					t.Status = Skip
+				}
+			}
+			if t.Status == Fail {
+				p.Status = Fail
+			}
+			p.Tests = append(p.Tests, t)
+			last, yaml = t, false
+			continue
+		}
+		if last == nil {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "---":
+			yaml = true
+		case trimmed == "...":
+			yaml = false
+		case yaml || strings.HasPrefix(line, "#"):
+			last.Output = append(last.Output, line)
+		}
+	}
+	return p
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Dedup remembers the most recent delivery ids.
+type Dedup struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is the most recent id
+	ids   map[string]*list.Element
+}
+
+// NewDedup returns a Dedup remembering up to size ids.
+func NewDedup(size int) *Dedup {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Dedup{size: size, order: list.New(), ids: map[string]*list.Element{}}
+}
+
+// Has reports whether id is recorded, without recording it.
+func (d *Dedup) Has(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.ids[id]
+	return ok
+}
+
+// Seen records id and reports whether it was already recorded.
+func (d *Dedup) Seen(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.ids[id]; ok {
+		d.order.MoveToFront(e)
+		return true
+	}
+	d.ids[id] = d.order.PushFront(id)
+	if d.order.Len() > d.size {
+		e := d.order.Back()
+		d.order.Remove(e)
+		delete(d.ids, e.Value.(string))
+	}
+	return false
+}
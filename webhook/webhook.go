@@ -0,0 +1,243 @@
+// Package webhook receives kci build notifications over HTTP. Handler checks
+// the Qiniu Mac signature and the age of each delivery, drops deliveries it
+// has already handled and calls the callback matching the event:
+//
+//	h := webhook.NewHandler(kciClient.NewMac(ak, sk))
+//	h.OnBuildFinished = func(ev *webhook.Event) error {
+//		log.Printf("%s #%d %s", ev.Project.ProjName, ev.Build.Number, ev.Build.Status)
+//		return nil
+//	}
+//	http.Handle("/kci/hook", h)
+//
+// Deliveries are signed by Sign, which covers the body whatever its content
+// type.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+// DeliveryHeader carries the id of a delivery. Retries of a delivery keep
+// its id. The X-Qiniu- prefix makes it part of the signature.
+const DeliveryHeader = "X-Qiniu-Kci-Delivery"
+
+// TimestampHeader carries the unix time a delivery was signed at, so that a
+// captured delivery cannot be replayed later. It is signed too.
+const TimestampHeader = "X-Qiniu-Kci-Timestamp"
+
+// DefaultMaxAge is how far the timestamp of a delivery may be from the
+// clock of the receiver.
+const DefaultMaxAge = 5 * time.Minute
+
+// MaxBodySize limits the payloads read by Handler.
+const MaxBodySize = 1 << 20
+
+// event types
+const (
+	BuildQueued   = "build.queued"
+	BuildStarted  = "build.started"
+	BuildFinished = "build.finished"
+	JobStarted    = "job.started"
+	JobFinished   = "job.finished"
+)
+
+// Payload is the body of a build notification. Job is set for job events.
+type Payload struct {
+	Project *kciClient.Project `json:"project"`
+	Build   *kciClient.Build   `json:"build"`
+	Job     *kciClient.Job     `json:"job,omitempty"`
+}
+
+// Event is a delivered notification.
+type Event struct {
+	Type     string // BuildQueued, BuildStarted, ...
+	Delivery string // DeliveryHeader, or a key derived from the payload
+	*Payload
+}
+
+// Type returns the event type of p, or "" if it carries no known event.
+func (p *Payload) Type() string {
+	if p.Build == nil {
+		return ""
+	}
+	if p.Job != nil {
+		switch {
+		case kciClient.IsDone(p.Job.Status):
+			return JobFinished
+		case p.Job.Status == kciClient.StatusRunning:
+			return JobStarted
+		}
+		return ""
+	}
+	switch {
+	case kciClient.IsDone(p.Build.Status):
+		return BuildFinished
+	case p.Build.Status == kciClient.StatusRunning:
+		return BuildStarted
+	case p.Build.Status == kciClient.StatusPending:
+		return BuildQueued
+	}
+	return ""
+}
+
+// key identifies the state change of p, for deliveries without an id.
+func (p *Payload) key() string {
+	proj := p.Build.ProjectId
+	if p.Project != nil {
+		proj = p.Project.ID
+	}
+	k := fmt.Sprintf("%d/%d/%s", proj, p.Build.Number, p.Build.Status)
+	if p.Job != nil {
+		k += fmt.Sprintf("/%d/%s", p.Job.Number, p.Job.Status)
+	}
+	return k
+}
+
+// Handler is an http.Handler receiving build notifications. Callbacks run
+// on the request goroutine before the response is written; slow work should
+// be handed off so the sender does not time out and retry. A callback error
+// is answered with 500, and the delivery is not recorded as handled so that
+// its retry is dispatched again.
+type Handler struct {
+	Mac   *kciClient.Mac // verifies signatures, nil accepts unsigned deliveries
+	Dedup *Dedup         // drops repeated deliveries, nil keeps them
+
+	// Host the deliveries are signed for, if not the Host header of the
+	// request, e.g. behind a proxy that rewrites it.
+	Host string
+	// MaxAge bounds the age of signed deliveries, see TimestampHeader.
+	// Zero means DefaultMaxAge, a negative value disables the check.
+	MaxAge time.Duration
+
+	OnBuildQueued   func(ev *Event) error
+	OnBuildStarted  func(ev *Event) error
+	OnBuildFinished func(ev *Event) error
+	OnJobStarted    func(ev *Event) error
+	OnJobFinished   func(ev *Event) error
+
+	// OnError, if set, is told about rejected deliveries.
+	OnError func(r *http.Request, err error)
+}
+
+// NewHandler returns a handler verifying signatures with mac and
+// remembering the last 1000 deliveries.
+func NewHandler(mac *kciClient.Mac) *Handler {
+	return &Handler{Mac: mac, Dedup: NewDedup(1000)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		h.reject(w, r, http.StatusMethodNotAllowed, fmt.Errorf("webhook: method %s", r.Method))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+	if h.Mac != nil {
+		if err := h.Mac.VerifyRequestBody(r, h.Host); err != nil {
+			h.reject(w, r, http.StatusUnauthorized, err)
+			return
+		}
+		if err := h.checkTime(r); err != nil {
+			h.reject(w, r, http.StatusUnauthorized, err)
+			return
+		}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		h.reject(w, r, http.StatusBadRequest, err)
+		return
+	}
+	ev, err := Parse(body)
+	if err != nil {
+		h.reject(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if id := r.Header.Get(DeliveryHeader); id != "" {
+		ev.Delivery = id
+	}
+	if h.Dedup != nil && h.Dedup.Has(ev.Delivery) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := h.Dispatch(ev); err != nil {
+		h.reject(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if h.Dedup != nil {
+		h.Dedup.Seen(ev.Delivery)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) checkTime(r *http.Request) error {
+	maxAge := h.MaxAge
+	if maxAge < 0 {
+		return nil
+	}
+	if maxAge == 0 {
+		maxAge = DefaultMaxAge
+	}
+	sec, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("webhook: missing or bad %s", TimestampHeader)
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > maxAge || age < -maxAge {
+		return fmt.Errorf("webhook: delivery signed %v ago, more than %v", age, maxAge)
+	}
+	return nil
+}
+
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, code int, err error) {
+	if h.OnError != nil {
+		h.OnError(r, err)
+	}
+	http.Error(w, http.StatusText(code), code)
+}
+
+// Dispatch calls the callback of ev.Type, if any, and returns its error.
+func (h *Handler) Dispatch(ev *Event) error {
+	var fn func(*Event) error
+	switch ev.Type {
+	case BuildQueued:
+		fn = h.OnBuildQueued
+	case BuildStarted:
+		fn = h.OnBuildStarted
+	case BuildFinished:
+		fn = h.OnBuildFinished
+	case JobStarted:
+		fn = h.OnJobStarted
+	case JobFinished:
+		fn = h.OnJobFinished
+	}
+	if fn == nil {
+		return nil
+	}
+	return fn(ev)
+}
+
+// Sign stamps a delivery with the current time and signs it with mac, body
+// included, for handlers verifying with the same keys.
+func Sign(mac *kciClient.Mac, req *http.Request) error {
+	req.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	return mac.SignRequestBody(req)
+}
+
+// Parse decodes a notification payload. Payloads without a build are
+// rejected; payloads in a state without an event get an empty Type.
+func Parse(body []byte) (*Event, error) {
+	p := new(Payload)
+	if err := json.Unmarshal(body, p); err != nil {
+		return nil, fmt.Errorf("webhook: %v", err)
+	}
+	if p.Build == nil {
+		return nil, fmt.Errorf("webhook: payload without build")
+	}
+	return &Event{Type: p.Type(), Delivery: p.key(), Payload: p}, nil
+}
@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u2takey/kci-sdk-go/kciClient"
+)
+
+const finished = `{"project":{"id":1,"name":"p"},"build":{"number":7,"status":"success"}}`
+
+var testMac = kciClient.NewMac("ak", "sk")
+
+// delivery returns a signed delivery of body; edit, if set, changes the
+// request after it is signed.
+func delivery(t *testing.T, body, ctype string, edit func(r *http.Request)) *http.Request {
+	r := httptest.NewRequest("POST", "http://hooks.example.com/kci/hook", strings.NewReader(body))
+	if ctype != "" {
+		r.Header.Set("Content-Type", ctype)
+	}
+	r.Header.Set(DeliveryHeader, "d1")
+	if err := Sign(testMac, r); err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		edit(r)
+	}
+	return r
+}
+
+func setBody(body string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.Body = ioutil.NopCloser(strings.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+}
+
+// resign signs r again with the given timestamp.
+func resign(t *testing.T, at time.Time) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set(TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+		if err := testMac.SignRequestBody(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	tampered := strings.Replace(finished, "success", "failure", 1)
+	tests := []struct {
+		name   string
+		method string
+		ctype  string
+		host   string // Handler.Host
+		maxAge time.Duration
+		edit   func(r *http.Request)
+		code   int
+		calls  int
+	}{
+		{"json", "POST", "application/json", "", 0, nil, 204, 1},
+		{"no content type", "POST", "", "", 0, nil, 204, 1},
+		{"tampered json", "POST", "application/json", "", 0, setBody(tampered), 401, 0},
+		{"tampered octet-stream", "POST", "application/octet-stream", "", 0, setBody(tampered), 401, 0},
+		{"tampered without content type", "POST", "", "", 0, setBody(tampered), 401, 0},
+		{"wrong key", "POST", "application/json", "", 0, func(r *http.Request) {
+			kciClient.NewMac("ak", "other").SignRequestBody(r)
+		}, 401, 0},
+		{"unsigned", "POST", "application/json", "", 0, func(r *http.Request) { r.Header.Del("Authorization") }, 401, 0},
+		{"stale", "POST", "application/json", "", 0, resign(t, time.Now().Add(-time.Hour)), 401, 0},
+		{"from the future", "POST", "application/json", "", 0, resign(t, time.Now().Add(time.Hour)), 401, 0},
+		{"stale within max age", "POST", "application/json", "", 2 * time.Hour, resign(t, time.Now().Add(-time.Hour)), 204, 1},
+		{"age not checked", "POST", "application/json", "", -1, resign(t, time.Now().Add(-time.Hour)), 204, 1},
+		{"no timestamp", "POST", "application/json", "", 0, func(r *http.Request) {
+			r.Header.Del(TimestampHeader)
+			testMac.SignRequestBody(r)
+		}, 401, 0},
+		{"host rewritten", "POST", "application/json", "", 0, func(r *http.Request) { r.Host = "10.0.0.1:8080" }, 401, 0},
+		{"host configured", "POST", "application/json", "hooks.example.com", 0, func(r *http.Request) { r.Host = "10.0.0.1:8080" }, 204, 1},
+		{"get", "GET", "", "", 0, nil, 405, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			h := NewHandler(testMac)
+			h.Host = tt.host
+			h.MaxAge = tt.maxAge
+			h.OnBuildFinished = func(ev *Event) error {
+				calls++
+				return nil
+			}
+			r := delivery(t, finished, tt.ctype, tt.edit)
+			r.Method = tt.method
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.code || calls != tt.calls {
+				t.Errorf("got %d with %d calls, want %d with %d", w.Code, calls, tt.code, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDedupAfterDispatch(t *testing.T) {
+	fail := true
+	calls := 0
+	h := NewHandler(testMac)
+	h.OnBuildFinished = func(ev *Event) error {
+		calls++
+		if fail {
+			return errors.New("database down")
+		}
+		return nil
+	}
+	steps := []struct {
+		fail  bool
+		code  int
+		calls int
+	}{
+		{true, 500, 1},  // failed, not recorded
+		{false, 204, 2}, // the retry is dispatched
+		{false, 204, 2}, // and recorded, so a second retry is dropped
+	}
+	for i, s := range steps {
+		fail = s.fail
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, delivery(t, finished, "application/json", nil))
+		if w.Code != s.code || calls != s.calls {
+			t.Errorf("delivery %d: got %d with %d calls, want %d with %d", i, w.Code, calls, s.code, s.calls)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		body     string
+		typ      string
+		delivery string
+		err      bool
+	}{
+		{finished, BuildFinished, "1/7/success", false},
+		{`{"build":{"projectId":2,"number":1,"status":"pending"}}`, BuildQueued, "2/1/pending", false},
+		{`{"build":{"projectId":2,"number":1,"status":"running"}}`, BuildStarted, "2/1/running", false},
+		{`{"build":{"projectId":2,"number":1,"status":"running"},"job":{"number":3,"status":"running"}}`, JobStarted, "2/1/running/3/running", false},
+		{`{"build":{"projectId":2,"number":1,"status":"running"},"job":{"number":3,"status":"failure"}}`, JobFinished, "2/1/running/3/failure", false},
+		{`{"build":{"projectId":2,"number":1,"status":"unknown"}}`, "", "2/1/unknown", false},
+		{`{"project":{"id":1}}`, "", "", true},
+		{`not json`, "", "", true},
+	}
+	for _, tt := range tests {
+		ev, err := Parse([]byte(tt.body))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: no error", tt.body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.body, err)
+			continue
+		}
+		if ev.Type != tt.typ || ev.Delivery != tt.delivery {
+			t.Errorf("%s: got %q %q, want %q %q", tt.body, ev.Type, ev.Delivery, tt.typ, tt.delivery)
+		}
+	}
+}
+
+func TestDedup(t *testing.T) {
+	d := NewDedup(2)
+	steps := []struct {
+		id   string
+		seen bool
+	}{
+		{"a", false}, {"b", false}, {"a", true}, {"c", false}, {"b", false}, {"a", false},
+	}
+	for _, s := range steps {
+		if got := d.Seen(s.id); got != s.seen {
+			t.Errorf("Seen(%s) = %v, want %v", s.id, got, s.seen)
+		}
+	}
+	if !d.Has("a") || d.Has("c") {
+		t.Errorf("Has: a %v, c %v", d.Has("a"), d.Has("c"))
+	}
+}